@@ -0,0 +1,126 @@
+package rwproxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClusterNotOpened is provided when the topology of a cluster is changed before any connections to it have been opened
+var ErrClusterNotOpened = errors.New("rwproxy: no connections have been opened to the cluster")
+
+// NodeNotFoundError is provided when a reader to be removed or drained is not in any cluster
+type NodeNotFoundError struct {
+	Name string
+}
+
+func (e NodeNotFoundError) Error() string {
+	return fmt.Sprintf("rwproxy: no reader named %#v", e.Name)
+}
+
+// AddReader adds a reader to the cluster of a compound DSN the Driver has opened, to be considered by new reader selections
+//
+// The topology is only changed if the cluster remains valid. Readers provided by a ReaderSource, or a configuration file, replace those
+// added when next refreshed. With WithShards, dsn may be the name of a shard, and with WithConfigFile, dsn is ignored.
+func (d *Driver) AddReader(dsn string, n Node) error {
+	cl, err := d.openedCluster(dsn)
+	if err != nil {
+		return err
+	}
+	if err := cl.addReader(n, d.validator); err != nil {
+		return err
+	}
+	d.debugf("reader added: %s", n)
+	return nil
+}
+
+// RemoveReader removes the reader with the given name (or DSN) from each cluster the Driver has opened
+//
+// Connections to the reader are closed when next used or reset by the connection pool, rather than while in use, so connections idle in
+// the pool hold them open until then (see sql.DB.SetConnMaxLifetime).
+func (d *Driver) RemoveReader(name string) error {
+	found := false
+	for _, cl := range d.openedClusters() {
+		if dsn, ok := cl.removeReader(name); ok {
+			found = true
+			d.debugf("reader removed; connections will be closed when next used: %s", dsn)
+		}
+	}
+	if !found {
+		return NodeNotFoundError{Name: name}
+	}
+	return nil
+}
+
+// DrainReader stops the reader with the given name (or DSN) from being selected, without removing it from its cluster
+//
+// Connections to the reader are closed when next used or reset by the connection pool, rather than while in use, so connections idle in
+// the pool hold them open until then (see sql.DB.SetConnMaxLifetime). If every reader of a cluster is drained, the writer is substituted.
+func (d *Driver) DrainReader(name string) error {
+	return d.setDrained(name, true)
+}
+
+// UndrainReader allows a reader drained by DrainReader to be selected again
+func (d *Driver) UndrainReader(name string) error {
+	return d.setDrained(name, false)
+}
+
+func (d *Driver) setDrained(name string, drained bool) error {
+	found := false
+	for _, cl := range d.openedClusters() {
+		if cl.setDrained(name, drained) {
+			found = true
+		}
+	}
+	if !found {
+		return NodeNotFoundError{Name: name}
+	}
+	if drained {
+		d.debugf("reader drained; connections will be closed when next used: %s", name)
+	} else {
+		d.debugf("reader undrained: %s", name)
+	}
+	return nil
+}
+
+// SetWriter replaces the writer of the cluster of a compound DSN the Driver has opened
+//
+// The topology is only changed if the cluster remains valid. If the writer is a writer candidate, the previous writer takes its place
+// among the candidates. Connections to the previous writer are closed when next used or reset, rather than while in use (or in a
+// transaction). With WithShards, dsn may be the name of a shard, and with WithConfigFile, dsn is ignored.
+func (d *Driver) SetWriter(dsn string, n Node) error {
+	cl, err := d.openedCluster(dsn)
+	if err != nil {
+		return err
+	}
+	if err := cl.setWriter(n, d.validator); err != nil {
+		return err
+	}
+	d.debugf("writer replaced: %s", n)
+	return nil
+}
+
+// openedCluster returns the cluster of a compound DSN (or with WithShards, of a shard by name), if the Driver has opened it
+func (d *Driver) openedCluster(dsn string) (*cluster, error) {
+	if d.shards != nil {
+		if shard, ok := d.shards.dsns[dsn]; ok {
+			dsn = shard
+		}
+	} else if d.config != nil {
+		// the cluster of the configuration file is registered by its path
+		dsn = d.config.path
+	}
+	if cl := d.existingCluster(dsn); cl != nil {
+		return cl, nil
+	}
+	return nil, ErrClusterNotOpened
+}
+
+// openedClusters returns the clusters the Driver has opened, in the order they were first opened
+func (d *Driver) openedClusters() []*cluster {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	clusters := make([]*cluster, len(d.clusterOrder))
+	copy(clusters, d.clusterOrder)
+	return clusters
+}
@@ -0,0 +1,185 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+	"github.com/nedscode/rwproxy/sqldrivermock"
+)
+
+func TestDriver_topologyChanges(t *testing.T) {
+	d := rwproxy.New(sqldrivermock.New())
+	defer d.Close()
+
+	dsn := rwproxy.MakeStructuredDSN(rwproxy.Node{DSN: "writer"}, rwproxy.Node{Name: "one", DSN: "reader-1"}, rwproxy.Node{DSN: "reader-2"})
+	if err := d.AddReader(dsn, rwproxy.Node{DSN: "reader-3"}); err != rwproxy.ErrClusterNotOpened {
+		t.Errorf("expected ErrClusterNotOpened; got %v", err)
+	}
+
+	c, err := d.Open(dsn)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+
+	targets := func(expected ...string) {
+		t.Helper()
+		ex, err := d.Explain(context.Background(), dsn, "SELECT", false, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(ex.Targets, expected) {
+			t.Errorf("targets mismatch: expected %v; got %v", expected, ex.Targets)
+		}
+	}
+
+	if err := d.DrainReader("one"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	targets("reader-2")
+	if readers := d.Topology().Clusters[0].Readers; !readers[0].Drained || readers[1].Drained {
+		t.Errorf("expected only reader-1 to be drained; got %+v", readers)
+	}
+	if err := d.DrainReader("reader-2"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	targets("writer")
+	if err := d.UndrainReader("reader-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	targets("reader-1")
+
+	if err := d.RemoveReader("reader-2"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := d.AddReader(dsn, rwproxy.Node{DSN: "reader-3"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	targets("reader-1", "reader-3")
+
+	if err := d.AddReader(dsn, rwproxy.Node{DSN: "writer"}); err == nil {
+		t.Errorf("expected error adding the writer as a reader")
+	}
+	if err := d.RemoveReader("reader-2"); err != (rwproxy.NodeNotFoundError{Name: "reader-2"}) {
+		t.Errorf("expected NodeNotFoundError; got %v", err)
+	}
+	if err := d.DrainReader("missing"); err != (rwproxy.NodeNotFoundError{Name: "missing"}) {
+		t.Errorf("expected NodeNotFoundError; got %v", err)
+	}
+
+	if err := d.SetWriter(dsn, rwproxy.Node{DSN: "reader-1"}); err == nil {
+		t.Errorf("expected error setting a reader as the writer")
+	}
+	if err := d.SetWriter(dsn, rwproxy.Node{DSN: "new-writer"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ex, err := d.Explain(context.Background(), dsn, "UPDATE", true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"new-writer"}; !reflect.DeepEqual(ex.Targets, expected) {
+		t.Errorf("targets mismatch: expected %v; got %v", expected, ex.Targets)
+	}
+}
+
+func TestDriver_DrainReader(t *testing.T) {
+	dname, rwproxyDrv, mockDrv := newRegisteredMockProxy(t, nil, nil)
+	expect := mockDrv.Expect()
+	defer func() {
+		if t.Failed() {
+			t.Log(expect.String())
+		}
+	}()
+
+	expect.Open().WithDSN("reader-1").Prepare().WithQuery("SELECT").Query()
+	expect.Open().WithDSN("reader-2").Prepare().WithQuery("SELECT").Query()
+	expect.Open().WithDSN("writer-2").Prepare().WithQuery("UPDATE").Exec()
+
+	db, err := sql.Open(dname, "writer;reader-1;reader-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	query := func() {
+		t.Helper()
+		rows, err := conn.QueryContext(context.Background(), "SELECT")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rows.Close()
+	}
+
+	query()
+	if err := rwproxyDrv.DrainReader("reader-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	query()
+	if stats := rwproxyDrv.Stats(); stats.ReaderConns["reader-1"] != 0 || stats.ReaderConns["reader-2"] != 1 {
+		t.Errorf("expected the reader-1 connection to be replaced by reader-2; got %v", stats.ReaderConns)
+	}
+
+	if err := rwproxyDrv.SetWriter("writer;reader-1;reader-2", rwproxy.Node{DSN: "writer-2"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "UPDATE"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := expect.Confirm(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestDriver_SetWriter_scoped(t *testing.T) {
+	d := rwproxy.New(sqldrivermock.New())
+	defer d.Close()
+
+	for _, dsn := range []string{"app-writer;app-reader", "billing-writer;billing-reader"} {
+		c, err := d.Open(dsn)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer c.Close()
+	}
+
+	if err := d.SetWriter("app-writer;app-reader", rwproxy.Node{DSN: "new-app-writer"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := d.AddReader("app-writer;app-reader", rwproxy.Node{DSN: "app-reader-2"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// only the cluster of the given compound DSN is changed
+	cases := []struct {
+		dsn     string
+		writer  string
+		readers []string
+	}{
+		{dsn: "app-writer;app-reader", writer: "new-app-writer", readers: []string{"app-reader", "app-reader-2"}},
+		{dsn: "billing-writer;billing-reader", writer: "billing-writer", readers: []string{"billing-reader"}},
+	}
+	for _, c := range cases {
+		w, err := d.Explain(context.Background(), c.dsn, "UPDATE", true, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		r, err := d.Explain(context.Background(), c.dsn, "SELECT", false, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(w.Targets, []string{c.writer}) || !reflect.DeepEqual(r.Targets, c.readers) {
+			t.Errorf("expected writer %s and readers %v for %s; got %v and %v", c.writer, c.readers, c.dsn, w.Targets, r.Targets)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package rwproxy
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql/driver"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type affinityKey struct{}
+
+// WithAffinityKey provides a context whose reads select their reader by key, e.g. a tenant ID, with ConsistentHashReaderSelector
+//
+// Reads with an affinity key select a reader for each query (or read-only transaction) rather than once per connection, reusing the
+// connection's delegate connection to the selected reader where it has one.
+func WithAffinityKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityKey{}, key)
+}
+
+// AffinityKey provides the affinity key of a context, if it has one (see WithAffinityKey)
+func AffinityKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(affinityKey{}).(string)
+	return key, ok
+}
+
+// ConsistentHashReaderSelector implements a strategy selecting the reader that the affinity key of the context (see WithAffinityKey)
+// hashes onto, so that reads for the same key consistently use the same reader, e.g. for better buffer pool locality
+//
+// Each reader is placed at replicas points (default 100) on a hash ring, so that only the keys of an added or removed reader are moved
+// to another. Reads without an affinity key are selected with next (or round robin, when nil).
+func ConsistentHashReaderSelector(replicas int, next ReaderSelector) ReaderSelector {
+	if replicas <= 0 {
+		replicas = 100
+	}
+	if next == nil {
+		next = RoundRobinReaderSelector()
+	}
+
+	var mu sync.Mutex
+	var readers string
+	var r ring
+	return func(ctx context.Context, d driver.Driver, dsns []string) (driver.Conn, error) {
+		key, ok := AffinityKey(ctx)
+		if !ok {
+			return next(ctx, d, dsns)
+		}
+
+		mu.Lock()
+		// the ring is only rebuilt when the readers change
+		if joined := strings.Join(dsns, "\x00"); joined != readers {
+			readers, r = joined, newRing(dsns, replicas)
+		}
+		dsn := r.locate(key)
+		mu.Unlock()
+
+		return d.Open(dsn)
+	}
+}
+
+// ring is a consistent hash ring of DSNs
+type ring struct {
+	points []uint32
+	dsns   map[uint32]string
+}
+
+func newRing(dsns []string, replicas int) ring {
+	r := ring{dsns: make(map[uint32]string, len(dsns)*replicas)}
+	for _, dsn := range dsns {
+		for i := 0; i < replicas; i++ {
+			p := hash(dsn + "#" + strconv.Itoa(i))
+			if _, ok := r.dsns[p]; ok {
+				continue
+			}
+			r.points = append(r.points, p)
+			r.dsns[p] = dsn
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// locate provides the DSN at the first point on the ring following the hash of key
+func (r ring) locate(key string) string {
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.dsns[r.points[i]]
+}
+
+// hash places a string on the ring, with MD5 for an even spread of similar strings (as with ketama)
+func hash(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
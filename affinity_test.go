@@ -0,0 +1,116 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestConsistentHashReaderSelector(t *testing.T) {
+	locate := func(s rwproxy.ReaderSelector, key string, dsns []string) string {
+		t.Helper()
+		conn, err := s(rwproxy.WithAffinityKey(context.Background(), key), &replicaSet{}, dsns)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return conn.(*replicaConn).dsn
+	}
+
+	s := rwproxy.ConsistentHashReaderSelector(0, nil)
+	all := []string{"reader-1", "reader-2", "reader-3", "reader-4"}
+	located := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		located[key] = locate(s, key, all)
+		counts[located[key]]++
+	}
+	for _, dsn := range all {
+		if counts[dsn] < 100 {
+			t.Errorf("expected keys to be spread across readers; got %v", counts)
+		}
+	}
+
+	// only the keys of a removed reader are moved
+	for key, dsn := range located {
+		moved := locate(s, key, all[:3])
+		if dsn != "reader-4" && moved != dsn {
+			t.Errorf("expected key %s to remain on %s; got %s", key, dsn, moved)
+		}
+		if moved == "reader-4" {
+			t.Errorf("expected key %s to be moved from reader-4", key)
+		}
+	}
+
+	// reads without a key are round robin
+	for _, expected := range all {
+		conn, err := s(context.Background(), &replicaSet{}, all)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if dsn := conn.(*replicaConn).dsn; dsn != expected {
+			t.Errorf("expected %s; got %s", expected, dsn)
+		}
+	}
+}
+
+func TestWithAffinityKey(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithReaderSelector(rwproxy.ConsistentHashReaderSelector(0, nil)))
+	conn, err := d.Open("writer;reader-1;reader-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	query := func(key string) {
+		t.Helper()
+		rows, err := conn.(driver.QueryerContext).QueryContext(rwproxy.WithAffinityKey(context.Background(), key), "SELECT", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := rows.Close(); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+
+	// queries for keys on different readers use a delegate connection to each, reused by later queries
+	for i := 0; i < 10; i++ {
+		query(strconv.Itoa(i))
+	}
+	if stats := d.Stats(); stats.ReaderConns["reader-1"] != 1 || stats.ReaderConns["reader-2"] != 1 {
+		t.Errorf("expected a connection to each reader; got %v", stats.ReaderConns)
+	}
+
+	conn.Close()
+	if stats := d.Stats(); len(stats.ReaderConns) != 0 {
+		t.Errorf("expected no reader connections; got %v", stats.ReaderConns)
+	}
+}
+
+func TestWithAffinityKey_idleReaders(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithReaderSelector(rwproxy.ConsistentHashReaderSelector(0, nil)))
+	conn, err := d.Open("writer;reader-1;reader-2;reader-3;reader-4")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	// only the current reader connection and the last one switched away from are kept, however many readers are used
+	for i := 0; i < 20; i++ {
+		rows, err := conn.(driver.QueryerContext).QueryContext(rwproxy.WithAffinityKey(context.Background(), strconv.Itoa(i)), "SELECT", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rows.Close()
+	}
+	total := 0
+	for _, n := range d.Stats().ReaderConns {
+		total += n
+	}
+	if total > 2 {
+		t.Errorf("expected at most 2 reader connections; got %v", d.Stats().ReaderConns)
+	}
+}
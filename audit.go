@@ -0,0 +1,215 @@
+package rwproxy
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a statement routed to a writer
+type AuditRecord struct {
+	Time  time.Time
+	Query string
+	// Args are the statement arguments, redacted by RedactArg
+	Args []string
+	Role string
+	// DSN is the delegate DSN that served the statement, redacted by RedactDSN
+	DSN string
+	// Exec reports whether the statement was an exec, rather than a query
+	Exec bool
+	// RowsAffected is the number of rows affected by an exec, or -1 if unknown
+	RowsAffected int64
+	Duration     time.Duration
+	Err          error
+}
+
+// Auditor is a function that is called with a record of every statement routed to a writer
+type Auditor func(AuditRecord)
+
+// RedactArg describes a statement argument by its type and size, rather than its value
+func RedactArg(v driver.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("string(%d)", len(v))
+	case []byte:
+		return fmt.Sprintf("[]byte(%d)", len(v))
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func auditObserver(a Auditor) observer {
+	return func(o *observation) {
+		if o.role != roleWriter {
+			return
+		}
+
+		r := AuditRecord{
+			Time:         o.start,
+			Query:        o.query,
+			Args:         make([]string, len(o.args)),
+			Role:         o.role,
+			DSN:          RedactDSN(o.dsn),
+			Exec:         o.exec,
+			RowsAffected: -1,
+			Duration:     o.duration + o.rowsDuration,
+			Err:          o.err,
+		}
+		for i, arg := range o.args {
+			r.Args[i] = RedactArg(arg.Value)
+		}
+		if o.res != nil {
+			if n, err := o.res.RowsAffected(); err == nil {
+				r.RowsAffected = n
+			}
+		}
+		a(r)
+	}
+}
+
+// JSONLinesAuditor appends AuditRecords to a file as JSON Lines, rotating the file once it reaches a maximum size
+//
+// Rotated files are renamed with the time of rotation as a suffix, and are never removed.
+type JSONLinesAuditor struct {
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	err  error
+}
+
+// jsonLinesRecord is the JSON encoding of an AuditRecord
+type jsonLinesRecord struct {
+	Time         time.Time `json:"time"`
+	Query        string    `json:"query"`
+	Args         []string  `json:"args"`
+	Role         string    `json:"role"`
+	DSN          string    `json:"dsn"`
+	Exec         bool      `json:"exec"`
+	RowsAffected int64     `json:"rows_affected"`
+	DurationMS   float64   `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// NewJSONLinesAuditor opens (or creates) the file at path for appending AuditRecords, rotating it once it reaches maxBytes
+//
+// A maxBytes of 0 disables rotation.
+func NewJSONLinesAuditor(path string, maxBytes int64) (*JSONLinesAuditor, error) {
+	a := &JSONLinesAuditor{path: path, maxBytes: maxBytes}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Audit appends a record to the file, and is an Auditor
+//
+// Any failure to write is retained, and reported by Err. A failure to rotate the file is also reported, but records continue to be
+// appended to it.
+func (a *JSONLinesAuditor) Audit(r AuditRecord) {
+	jr := jsonLinesRecord{
+		Time:         r.Time,
+		Query:        r.Query,
+		Args:         r.Args,
+		Role:         r.Role,
+		DSN:          r.DSN,
+		Exec:         r.Exec,
+		RowsAffected: r.RowsAffected,
+		DurationMS:   float64(r.Duration) / float64(time.Millisecond),
+	}
+	if r.Err != nil {
+		jr.Error = r.Err.Error()
+	}
+	line, err := json.Marshal(jr)
+	if err != nil {
+		a.failed(err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		a.err = os.ErrClosed
+		return
+	}
+	if a.maxBytes > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			a.err = err
+			if a.f == nil {
+				// the file couldn't be reopened
+				return
+			}
+		}
+	}
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		a.err = err
+	}
+}
+
+// Err returns the most recent error encountered writing records, if any
+func (a *JSONLinesAuditor) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.err
+}
+
+// Close closes the file
+func (a *JSONLinesAuditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+func (a *JSONLinesAuditor) failed(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.err = err
+}
+
+func (a *JSONLinesAuditor) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.f = f
+	a.size = fi.Size()
+	return nil
+}
+
+func (a *JSONLinesAuditor) rotate() error {
+	if err := a.f.Close(); err != nil {
+		return err
+	}
+	a.f = nil
+	rotated := a.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	renameErr := os.Rename(a.path, rotated)
+	// reopen regardless, so that records continue to be written if the rename failed
+	if err := a.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
@@ -0,0 +1,167 @@
+package rwproxy_test
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithAuditor(t *testing.T) {
+	var records []rwproxy.AuditRecord
+	dname, _, mockDrv := newRegisteredMockProxy(t, []rwproxy.Option{
+		rwproxy.WithAuditor(func(r rwproxy.AuditRecord) { records = append(records, r) }),
+	}, nil)
+	expect := mockDrv.Expect()
+	defer func() {
+		if t.Failed() {
+			t.Log(expect.String())
+		}
+	}()
+
+	expect.Open().WithDSN("my-reader").Prepare().WithQuery("SELECT").Query()
+	expect.Open().WithDSN("user:secret@my-writer").Prepare().WithQuery("UPDATE").Exec()
+
+	db, err := sql.Open(dname, "user:secret@my-writer;my-reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+	if _, err := db.Exec("UPDATE", 42, "hello", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected only the writer exec to be audited, got %+v", records)
+	}
+	r := records[0]
+	if r.Query != "UPDATE" || r.Role != "writer" || r.DSN != "user:xxxxx@my-writer" || !r.Exec || r.RowsAffected != -1 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if expected := []string{"int64", "string(5)", "NULL"}; len(r.Args) != 3 || r.Args[0] != expected[0] || r.Args[1] != expected[1] || r.Args[2] != expected[2] {
+		t.Errorf("args mismatch: expected %v; got %v", expected, r.Args)
+	}
+
+	if err := expect.Confirm(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestJSONLinesAuditor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rwproxy")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	a, err := rwproxy.NewJSONLinesAuditor(path, 500)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	record := rwproxy.AuditRecord{
+		Time:         time.Now(),
+		Query:        "UPDATE t SET v = ? WHERE id = ?",
+		Args:         []string{"string(3)", "int64"},
+		Role:         "writer",
+		DSN:          "my-writer",
+		Exec:         true,
+		RowsAffected: 1,
+		Err:          errors.New("boom"),
+	}
+	for i := 0; i < 3; i++ {
+		a.Audit(record)
+	}
+	if err := a.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected the file to have been rotated once, got %v", files)
+	}
+
+	lines := 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if line["query"] != record.Query || line["error"] != "boom" {
+				t.Errorf("unexpected line: %s", s.Text())
+			}
+			lines++
+		}
+		f.Close()
+	}
+	if lines != 3 {
+		t.Errorf("expected 3 records, got %d", lines)
+	}
+}
+
+func TestJSONLinesAuditor_rotateFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rwproxy")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	a, err := rwproxy.NewJSONLinesAuditor(path, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer a.Close()
+
+	record := rwproxy.AuditRecord{Query: "UPDATE t SET v = 1", Role: "writer"}
+	a.Audit(record)
+
+	// the file can't be renamed once removed, failing its rotation
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a.Audit(record)
+	if err := a.Err(); err == nil {
+		t.Errorf("expected error rotating the file")
+	}
+
+	// the record is still written, to the reopened file
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal(b, &line); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if line["query"] != record.Query {
+		t.Errorf("unexpected line: %s", b)
+	}
+}
@@ -0,0 +1,83 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Balancer implements a read distribution strategy, with feedback on the readers it picks (see WithBalancer)
+//
+// A ReaderSelector is a strategy without feedback.
+type Balancer interface {
+	// Pick picks a reader by DSN, for rwproxy to open a delegate connection to (or reuse one, see WithAffinityKey)
+	Pick(ctx context.Context, readerDSNs []string) (string, error)
+	// Report is called with the latency and outcome of each query (or statement) against a reader, including failures to open a
+	// delegate connection to a picked reader
+	Report(dsn string, latency time.Duration, err error)
+	// Release is called once a delegate connection to a reader has been closed
+	Release(dsn string)
+}
+
+// WithBalancer creates an Option for the given Balancer implementation, reporting the use of each reader to it
+func WithBalancer(b Balancer) Option {
+	return func(d *Driver) {
+		d.balancer = b
+		d.feedback = true
+	}
+}
+
+type dialerKey struct{}
+
+// selectorBalancer adapts a ReaderSelector to a Balancer, opening the delegate connection to the reader it picks with the dialer of
+// the pick's context
+type selectorBalancer struct {
+	ReaderSelector
+}
+
+func (s selectorBalancer) Pick(ctx context.Context, readerDSNs []string) (string, error) {
+	d := ctx.Value(dialerKey{}).(*dialer)
+	c, err := s.ReaderSelector(ctx, d, readerDSNs)
+	if err != nil {
+		return "", err
+	}
+	d.conn = c
+	return d.dsn, nil
+}
+
+func (s selectorBalancer) Report(dsn string, latency time.Duration, err error) {}
+
+func (s selectorBalancer) Release(dsn string) {}
+
+// pick opens a delegate connection to the reader picked by the Balancer, or provides the delegate connection opened by a
+// ReaderSelector
+func (d *Driver) pick(ctx context.Context, dl *dialer, readers []string) (driver.Conn, error) {
+	b := d.balancerFor(ReaderGroup(ctx))
+	dsn, err := b.Pick(context.WithValue(ctx, dialerKey{}, dl), readers)
+	if err != nil {
+		return nil, err
+	}
+	if dl.conn != nil {
+		return dl.conn, nil
+	}
+	c, err := dl.Open(dsn)
+	if err != nil {
+		b.Report(dsn, 0, err)
+	}
+	return c, err
+}
+
+// released reports the closure of a delegate connection to a reader to the Balancer
+func (d *Driver) released(pc *proxiedConn) {
+	if pc.role == roleReader {
+		d.balancerFor(pc.group).Release(pc.dsn)
+	}
+}
+
+// balancerObserver reports the latency and outcome of queries against readers to the Balancer of their reader group
+func balancerObserver(o *observation) {
+	if o.role != roleReader || o.err == context.Canceled || o.err == context.DeadlineExceeded {
+		return
+	}
+	o.driver.balancerFor(o.group).Report(o.dsn, o.duration, o.err)
+}
@@ -0,0 +1,96 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+// recordingBalancer picks the last reader, recording the feedback it is given
+type recordingBalancer struct {
+	mu       sync.Mutex
+	feedback []string
+}
+
+func (b *recordingBalancer) Pick(ctx context.Context, dsns []string) (string, error) {
+	b.record("pick %s", dsns[len(dsns)-1])
+	return dsns[len(dsns)-1], nil
+}
+
+func (b *recordingBalancer) Report(dsn string, latency time.Duration, err error) {
+	b.record("report %s: %v", dsn, err)
+}
+
+func (b *recordingBalancer) Release(dsn string) {
+	b.record("release %s", dsn)
+}
+
+func (b *recordingBalancer) record(format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.feedback = append(b.feedback, fmt.Sprintf(format, args...))
+}
+
+func TestWithBalancer(t *testing.T) {
+	cases := []struct {
+		name     string
+		down     string
+		expected []string
+	}{
+		{
+			name: "reader",
+			expected: []string{
+				"pick reader-2",
+				"report reader-2: <nil>",
+				"release reader-2",
+			},
+		},
+		{
+			name: "reader down",
+			down: "reader-2",
+			expected: []string{
+				"pick reader-2",
+				"report reader-2: connection refused",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := &recordingBalancer{}
+			d := rwproxy.New(&replicaSet{primary: "writer", down: c.down}, rwproxy.WithBalancer(b))
+			conn, err := d.Open("writer;reader-1;reader-2")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := rows.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err := conn.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			if len(b.feedback) != len(c.expected) {
+				t.Fatalf("expected %v; got %v", c.expected, b.feedback)
+			}
+			for i := range c.expected {
+				if b.feedback[i] != c.expected[i] {
+					t.Errorf("expected %v; got %v", c.expected, b.feedback)
+				}
+			}
+			if selector := d.Topology().Selector; selector != "rwproxy_test.recordingBalancer" {
+				t.Errorf("expected selector rwproxy_test.recordingBalancer; got %s", selector)
+			}
+		})
+	}
+}
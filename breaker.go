@@ -0,0 +1,165 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is provided when a connection to a node is not attempted, as its circuit breaker is open
+var ErrCircuitOpen = errors.New("rwproxy: circuit breaker open")
+
+// States of a node's circuit breaker, provided as NodeTopology.Circuit
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker configures the per-node circuit breakers of WithCircuitBreaker
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failures that open a node's circuit (default 5)
+	Failures int
+	// OpenDuration is how long a circuit remains open before it is half-opened and probed (default 30 seconds)
+	OpenDuration time.Duration
+	// Probes is the number of consecutive successful probes that close a half-open circuit (default 1)
+	Probes int
+	// ProbeInterval is how often half-open circuits are probed (default 1 second)
+	ProbeInterval time.Duration
+}
+
+// breakers are the circuit breakers of each node, by DSN
+type breakers struct {
+	CircuitBreaker
+
+	mu    sync.Mutex
+	nodes map[string]*breaker
+}
+
+type breaker struct {
+	state     string
+	failures  int
+	successes int
+	openedAt  time.Time
+}
+
+func newBreakers(cb CircuitBreaker) *breakers {
+	if cb.Failures <= 0 {
+		cb.Failures = 5
+	}
+	if cb.OpenDuration <= 0 {
+		cb.OpenDuration = 30 * time.Second
+	}
+	if cb.Probes <= 0 {
+		cb.Probes = 1
+	}
+	if cb.ProbeInterval <= 0 {
+		cb.ProbeInterval = time.Second
+	}
+	return &breakers{CircuitBreaker: cb, nodes: map[string]*breaker{}}
+}
+
+// state provides the state of a node's circuit
+func (bs *breakers) state(dsn string) string {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if b := bs.nodes[dsn]; b != nil {
+		return b.state
+	}
+	return CircuitClosed
+}
+
+// record counts the success or failure of a connection or statement against a node, reporting any change of state
+func (bs *breakers) record(dsn string, err error) (string, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	b := bs.nodes[dsn]
+	if b == nil {
+		if err == nil {
+			return CircuitClosed, false
+		}
+		b = &breaker{state: CircuitClosed}
+		bs.nodes[dsn] = b
+	}
+
+	was := b.state
+	switch {
+	case err != nil && b.state == CircuitClosed:
+		if b.failures++; b.failures >= bs.Failures {
+			b.state, b.openedAt = CircuitOpen, time.Now()
+		}
+	case err != nil:
+		b.state, b.openedAt, b.successes = CircuitOpen, time.Now(), 0
+	case b.state == CircuitHalfOpen:
+		if b.successes++; b.successes >= bs.Probes {
+			delete(bs.nodes, dsn)
+			return CircuitClosed, true
+		}
+	case b.state == CircuitClosed:
+		delete(bs.nodes, dsn)
+	}
+	return b.state, b.state != was
+}
+
+// halfOpen half-opens circuits that have been open for OpenDuration, providing the DSNs of all half-open circuits
+func (bs *breakers) halfOpen() []string {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	dsns := []string{}
+	for dsn, b := range bs.nodes {
+		if b.state == CircuitOpen && time.Since(b.openedAt) >= bs.OpenDuration {
+			b.state, b.successes = CircuitHalfOpen, 0
+		}
+		if b.state == CircuitHalfOpen {
+			dsns = append(dsns, dsn)
+		}
+	}
+	return dsns
+}
+
+// allow reports ErrCircuitOpen if a connection to a node should not be attempted
+func (d *Driver) allow(dsn string) error {
+	if d.breakers != nil && d.breakers.state(dsn) != CircuitClosed {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// tripped records the outcome of using a node against its circuit breaker
+func (d *Driver) tripped(dsn string, err error) {
+	if d.breakers == nil {
+		return
+	}
+	if state, changed := d.breakers.record(dsn, err); changed {
+		d.debugf("circuit %s: %s", state, dsn)
+	}
+}
+
+// probeBreakers probes the nodes of half-open circuits, by opening and pinging a connection to each
+func (d *Driver) probeBreakers() {
+	for _, dsn := range d.breakers.halfOpen() {
+		ctx, cancel := context.WithTimeout(context.Background(), d.breakers.ProbeInterval)
+		pc, err := d.proxiedDriver.Open(dsn)
+		if err == nil {
+			err = ping(ctx, pc)
+			pc.Close()
+		}
+		cancel()
+		d.dialed(dsn, err)
+	}
+}
+
+// breakerObserver records connection failures of statements against their node's circuit breaker
+func breakerObserver(o *observation) {
+	switch o.err {
+	case nil:
+		o.driver.tripped(o.dsn, nil)
+	case driver.ErrBadConn:
+		o.driver.tripped(o.dsn, o.err)
+	}
+}
@@ -0,0 +1,64 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	rs := &replicaSet{primary: "writer", down: "reader-1"}
+	d := rwproxy.New(rs, rwproxy.WithCircuitBreaker(rwproxy.CircuitBreaker{
+		Failures:      2,
+		OpenDuration:  10 * time.Millisecond,
+		ProbeInterval: time.Millisecond,
+	}))
+	defer d.Close()
+
+	dsn := "writer;reader-1;reader-2"
+	targets := func() []string {
+		ex, err := d.Explain(context.Background(), dsn, "SELECT", false, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return ex.Targets
+	}
+
+	// each connection selects the next reader, so every other connection fails to open reader-1, until its circuit opens
+	for i := 0; i < 4; i++ {
+		c, err := d.Open(dsn)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := c.(driver.Pinger).Ping(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer c.Close()
+	}
+	if circuit := d.Topology().Clusters[0].Readers[0].Circuit; circuit != rwproxy.CircuitOpen {
+		t.Errorf("expected reader-1 circuit to be open; got %s", circuit)
+	}
+	if expected := []string{"reader-2"}; !reflect.DeepEqual(targets(), expected) {
+		t.Errorf("targets mismatch: expected %v; got %v", expected, targets())
+	}
+	if stats := d.Stats(); stats.Fallbacks != 2 {
+		t.Errorf("expected 2 fallbacks; got %d", stats.Fallbacks)
+	}
+
+	// the circuit closes once a background probe succeeds
+	rs.setDown("")
+	deadline := time.Now().Add(time.Second)
+	for d.Topology().Clusters[0].Readers[0].Circuit != rwproxy.CircuitClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected reader-1 circuit to close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if expected := []string{"reader-1", "reader-2"}; !reflect.DeepEqual(targets(), expected) {
+		t.Errorf("targets mismatch: expected %v; got %v", expected, targets())
+	}
+}
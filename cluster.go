@@ -0,0 +1,302 @@
+package rwproxy
+
+import (
+	"sync"
+)
+
+// cluster is the writer and readers of a compound DSN, shared by all connections opened against it
+//
+// The writer and readers may change while connections are open, each change incrementing the writer or reader generation of the
+// cluster, so that connections can close any delegate connections made stale by the change.
+type cluster struct {
+	mu        sync.RWMutex
+	c         Cluster
+	drained   map[string]bool
+	stale     map[string]bool
+	writerGen int
+	readerGen int
+	// degraded is set while the writer is unavailable, in degraded mode
+	degraded bool
+
+	// failoverMu serialises searches for a new primary
+	failoverMu sync.Mutex
+}
+
+// newCluster parses a compound DSN into a cluster
+//
+// Without a DSNValidator, compound DSNs are accepted as leniently as by ParseCompoundDSN, only an empty writer being rejected (as an
+// IncompleteDSNError). With one, the compound DSN is validated as by ParseCompoundDSNStrict.
+func newCluster(name string, validate DSNValidator) (*cluster, error) {
+	c, err := ParseCluster(name)
+	if err != nil {
+		return nil, err
+	}
+	if validate == nil {
+		if c.Writer.DSN == "" {
+			return nil, IncompleteDSNError{DSN: name}
+		}
+		return &cluster{c: c}, nil
+	}
+	if err := c.validate(name, validate); err != nil {
+		return nil, err
+	}
+	return &cluster{c: c}, nil
+}
+
+// spec returns a copy of the current writer and readers
+func (cl *cluster) spec() Cluster {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	c := cl.c
+	c.Readers = make([]Node, len(cl.c.Readers))
+	copy(c.Readers, cl.c.Readers)
+	c.Candidates = make([]Node, len(cl.c.Candidates))
+	copy(c.Candidates, cl.c.Candidates)
+	return c
+}
+
+func (cl *cluster) writer() Node {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	return cl.c.Writer
+}
+
+// writerGeneration identifies the current writer
+func (cl *cluster) writerGeneration() int {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	return cl.writerGen
+}
+
+// readerGeneration identifies the current set of readers, and whether they are drained
+func (cl *cluster) readerGeneration() int {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	return cl.readerGen
+}
+
+func (cl *cluster) isDegraded() bool {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	return cl.degraded
+}
+
+// setDegraded enters or leaves degraded mode, reporting whether the mode changed
+func (cl *cluster) setDegraded(degraded bool) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	changed := cl.degraded != degraded
+	cl.degraded = degraded
+	return changed
+}
+
+// selectable reports whether a reader is in the cluster, and not drained
+func (cl *cluster) selectable(dsn string) bool {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	for _, n := range cl.c.Readers {
+		if n.DSN == dsn {
+			return !cl.drained[dsn] && !cl.stale[dsn]
+		}
+	}
+	return false
+}
+
+// reader provides the reader with the given DSN
+func (cl *cluster) reader(dsn string) (Node, bool) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	for _, n := range cl.c.Readers {
+		if n.DSN == dsn {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
+
+// isDrained reports whether a reader has been drained
+func (cl *cluster) isDrained(dsn string) bool {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	return cl.drained[dsn]
+}
+
+// isStale reports whether a reader has been found to be lagging by WithLagProbe
+func (cl *cluster) isStale(dsn string) bool {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	return cl.stale[dsn]
+}
+
+// setStale marks a reader as stale (or not), reporting whether it changed
+func (cl *cluster) setStale(dsn string, stale bool) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.stale[dsn] == stale {
+		return false
+	}
+	if cl.stale == nil {
+		cl.stale = map[string]bool{}
+	}
+	if stale {
+		cl.stale[dsn] = true
+	} else {
+		delete(cl.stale, dsn)
+	}
+	cl.readerGen++
+	return true
+}
+
+// setReaders atomically replaces the readers, returning the DSNs of any readers removed
+func (cl *cluster) setReaders(readers []Node) []string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return cl.replaceReaders(readers)
+}
+
+// replaceReaders replaces the readers while cl.mu is held
+func (cl *cluster) replaceReaders(readers []Node) []string {
+	kept := map[string]bool{}
+	for _, n := range readers {
+		kept[n.DSN] = true
+	}
+	removed := []string{}
+	for _, n := range cl.c.Readers {
+		if !kept[n.DSN] {
+			removed = append(removed, n.DSN)
+			delete(cl.drained, n.DSN)
+			delete(cl.stale, n.DSN)
+		}
+	}
+
+	cl.c.Readers = make([]Node, len(readers))
+	copy(cl.c.Readers, readers)
+	cl.readerGen++
+	return removed
+}
+
+// addReader adds a reader, if the cluster remains valid
+func (cl *cluster) addReader(n Node, validate DSNValidator) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	c := Cluster{Writer: cl.c.Writer, Readers: make([]Node, len(cl.c.Readers), len(cl.c.Readers)+1), Candidates: cl.c.Candidates}
+	copy(c.Readers, cl.c.Readers)
+	c.Readers = append(c.Readers, n)
+	if err := c.Validate(validate); err != nil {
+		return err
+	}
+	cl.c = c
+	cl.readerGen++
+	return nil
+}
+
+// removeReader removes the reader identified by name, returning its DSN if it was found
+func (cl *cluster) removeReader(name string) (string, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for i, n := range cl.c.Readers {
+		if n.Name == name || n.DSN == name {
+			readers := make([]Node, 0, len(cl.c.Readers)-1)
+			readers = append(readers, cl.c.Readers[:i]...)
+			cl.c.Readers = append(readers, cl.c.Readers[i+1:]...)
+			delete(cl.drained, n.DSN)
+			delete(cl.stale, n.DSN)
+			cl.readerGen++
+			return n.DSN, true
+		}
+	}
+	return "", false
+}
+
+// setDrained drains (or undrains) the reader identified by name, reporting whether it was found
+func (cl *cluster) setDrained(name string, drained bool) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for _, n := range cl.c.Readers {
+		if n.Name == name || n.DSN == name {
+			if cl.drained == nil {
+				cl.drained = map[string]bool{}
+			}
+			if drained {
+				cl.drained[n.DSN] = true
+			} else {
+				delete(cl.drained, n.DSN)
+			}
+			cl.readerGen++
+			return true
+		}
+	}
+	return false
+}
+
+// setWriter replaces the writer, if the cluster remains valid
+//
+// If the new writer is a writer candidate, the previous writer takes its place among the candidates.
+func (cl *cluster) setWriter(w Node, validate DSNValidator) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	c := cl.withWriter(w)
+	if err := c.Validate(validate); err != nil {
+		return err
+	}
+	cl.c = c
+	cl.writerGen++
+	return nil
+}
+
+// promote makes a writer candidate the writer, with the previous writer taking its place among the candidates
+func (cl *cluster) promote(w Node) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.c.Candidates = cl.promotedCandidates(w)
+	cl.c.Writer = w
+	cl.writerGen++
+}
+
+// withWriter provides the cluster as it would be with a new writer, while cl.mu is held
+func (cl *cluster) withWriter(w Node) Cluster {
+	return Cluster{Writer: w, Readers: cl.c.Readers, Candidates: cl.promotedCandidates(w)}
+}
+
+func (cl *cluster) promotedCandidates(w Node) []Node {
+	candidates := make([]Node, len(cl.c.Candidates))
+	copy(candidates, cl.c.Candidates)
+	for i, n := range candidates {
+		if n.DSN == w.DSN {
+			candidates[i] = cl.c.Writer
+		}
+	}
+	return candidates
+}
+
+// replace atomically replaces the writer, readers and writer candidates, returning the DSNs of any readers removed
+func (cl *cluster) replace(c Cluster) []string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	removed := cl.replaceReaders(c.Readers)
+	if c.Writer.DSN != cl.c.Writer.DSN {
+		cl.writerGen++
+	}
+	cl.c.Writer = c.Writer
+	cl.c.Candidates = make([]Node, len(c.Candidates))
+	copy(cl.c.Candidates, c.Candidates)
+	return removed
+}
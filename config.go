@@ -0,0 +1,126 @@
+package rwproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigDecoder decodes the contents of a configuration file into a Cluster
+//
+// Decoders are selected by file extension. JSON (".json") is supported by default, in the same format as a structured compound DSN.
+// Other formats may be supported by providing their Unmarshal function, as the lowercased field names of Cluster and Node are their keys:
+//
+//	rwproxy.WithConfigDecoder(".yaml", func(data []byte, c *rwproxy.Cluster) error {
+//		return yaml.Unmarshal(data, c)
+//	})
+type ConfigDecoder func(data []byte, c *Cluster) error
+
+// ConfigFileError indicates that a configuration file could not be loaded
+type ConfigFileError struct {
+	Path string
+	Err  error
+}
+
+func (e ConfigFileError) Error() string {
+	return fmt.Sprintf("rwproxy: failed to load configuration file %s: %s", e.Path, e.Err)
+}
+
+func decodeJSONConfig(data []byte, c *Cluster) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(c)
+}
+
+// configFile is a cluster loaded from, and reloaded as changes are made to, a file
+type configFile struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cluster *cluster
+	modTime time.Time
+	size    int64
+}
+
+// configCluster returns the cluster loaded from the configuration file, loading it if it has not yet been loaded successfully
+func (d *Driver) configCluster() (*cluster, error) {
+	d.config.mu.Lock()
+	cl := d.config.cluster
+	d.config.mu.Unlock()
+	if cl != nil {
+		return cl, nil
+	}
+
+	if err := d.reloadConfig(); err != nil {
+		return nil, err
+	}
+	d.config.mu.Lock()
+	defer d.config.mu.Unlock()
+	return d.config.cluster, nil
+}
+
+// reloadConfig loads the configuration file if it has changed since it was last loaded
+//
+// The first successful load creates the cluster; later loads replace its writer, readers and writer candidates.
+func (d *Driver) reloadConfig() error {
+	cf := d.config
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	fi, err := os.Stat(cf.path)
+	if err != nil {
+		return ConfigFileError{Path: cf.path, Err: err}
+	}
+	if cf.cluster != nil && fi.ModTime().Equal(cf.modTime) && fi.Size() == cf.size {
+		return nil
+	}
+
+	decode, ok := d.configDecoders[strings.ToLower(filepath.Ext(cf.path))]
+	if !ok {
+		return ConfigFileError{Path: cf.path, Err: fmt.Errorf("no ConfigDecoder for %#v", filepath.Ext(cf.path))}
+	}
+	data, err := ioutil.ReadFile(cf.path)
+	if err != nil {
+		return ConfigFileError{Path: cf.path, Err: err}
+	}
+	var c Cluster
+	if err := decode(data, &c); err != nil {
+		return ConfigFileError{Path: cf.path, Err: err}
+	}
+	if err := c.validate(cf.path, d.validator); err != nil {
+		return ConfigFileError{Path: cf.path, Err: err}
+	}
+	cf.modTime, cf.size = fi.ModTime(), fi.Size()
+
+	if cf.cluster == nil {
+		d.debugf("loaded configuration file: %s", cf.path)
+		cf.cluster = &cluster{c: c}
+		d.registerCluster(cf.path, cf.cluster)
+		return nil
+	}
+
+	d.debugf("reloaded configuration file: %s", cf.path)
+	if w := cf.cluster.writer(); w.DSN != c.Writer.DSN {
+		d.debugf("writer replaced; connections will be closed when next used: %s", w)
+	}
+	for _, dsn := range cf.cluster.replace(c) {
+		d.debugf("reader removed; connections will be closed when next used: %s", dsn)
+	}
+	return nil
+}
+
+// watchConfig periodically reloads the configuration file until the Driver is closed
+func (d *Driver) watchConfig() {
+	d.every(d.config.interval, func() {
+		if err := d.reloadConfig(); err != nil {
+			d.debugf("%s", err)
+		}
+	})
+}
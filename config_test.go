@@ -0,0 +1,103 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+	"github.com/nedscode/rwproxy/sqldrivermock"
+)
+
+func TestWithConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rwproxy")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cluster.json")
+	writeConfig := func(readers ...rwproxy.Node) {
+		if err := ioutil.WriteFile(path, []byte(rwproxy.MakeStructuredDSN(rwproxy.Node{DSN: "writer"}, readers...)), 0600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		// ensure the change is visible regardless of the filesystem's timestamp resolution
+		mtime := time.Now().Add(time.Duration(len(readers)) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	writeConfig(rwproxy.Node{DSN: "reader-1"})
+
+	dname, rwproxyDrv, mockDrv := newRegisteredMockProxy(t, []rwproxy.Option{rwproxy.WithConfigFile(path, time.Millisecond)}, nil)
+	defer rwproxyDrv.Close()
+	expect := mockDrv.Expect()
+	defer func() {
+		if t.Failed() {
+			t.Log(expect.String())
+		}
+	}()
+
+	expect.Open().WithDSN("reader-1").Prepare().WithQuery("SELECT").Query()
+	expect.Open().WithDSN("reader-2").Prepare().WithQuery("SELECT").Query()
+
+	// the DSN is ignored
+	db, err := sql.Open(dname, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	query := func() {
+		rows, err := db.Query("SELECT")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rows.Close()
+	}
+	query()
+
+	writeConfig(rwproxy.Node{DSN: "reader-2"}, rwproxy.Node{DSN: "reader-3"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		topo := rwproxyDrv.Topology()
+		if len(topo.Clusters) == 1 && len(topo.Clusters[0].Readers) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for configuration reload: %+v", topo.Clusters)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the DSN is ignored when explaining too
+	ex, err := rwproxyDrv.Explain(context.Background(), "ignored", "SELECT", false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(ex.Targets, []string{"reader-2", "reader-3"}) {
+		t.Errorf("expected the configured readers; got %v", ex.Targets)
+	}
+
+	// reader-1 was removed, so is replaced by a new selection
+	query()
+
+	if err := expect.Confirm(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestWithConfigFile_invalid(t *testing.T) {
+	d := rwproxy.New(sqldrivermock.New(), rwproxy.WithConfigFile(filepath.Join(os.TempDir(), "rwproxy-missing.json"), 0))
+	if _, err := d.Open(""); err == nil {
+		t.Errorf("expected error")
+	} else if _, ok := err.(rwproxy.ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError, got %#v", err)
+	}
+}
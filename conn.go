@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ConnCloseError is provided when conn.Close() fails, encapsulating errors from one or both proxied connections
@@ -33,11 +34,27 @@ var ErrUnexpectedTxClose = errors.New("rwproxy: unexpected proxied transaction c
 type conn struct {
 	driver *Driver
 
-	writerDSN  string
-	readerDSNs []string
+	cluster *cluster
 
 	writerConn *proxiedConn
 	readerConn *proxiedConn
+	// writerGen is the generation of the cluster's writer when writerConn was opened
+	writerGen int
+	// readerGen is the generation of the cluster's readers when readerConn was selected
+	readerGen int
+	// readerGroup is the reader group that readerConn was selected from
+	readerGroup string
+	// fallback describes why the writer was substituted for an unavailable reader, if it was
+	fallback *Fallback
+	// hedgeConn is a second reader connection, to a different reader, for hedged reads
+	hedgeConn *proxiedConn
+	// shardConns are the connections to each shard used, by name, when WithShards is in use
+	shardConns map[string]*conn
+	// session records the session settings to replay on every delegate connection, shared with any shards
+	session *session
+	// idleReaders are reader connections other than readerConn, by DSN, kept for reads with an affinity key (see WithAffinityKey) or of
+	// another reader group; there is at most one
+	idleReaders map[string]*proxiedConn
 
 	tx *tx
 }
@@ -46,48 +63,311 @@ func (c *conn) writer(ctx context.Context) (*proxiedConn, error) {
 	if c.tx != nil {
 		return c.tx.driverConn, nil
 	}
+	if c.shardConns != nil {
+		s, err := c.shard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.writer(ctx)
+	}
+
+	if c.writerConn != nil && c.writerGen != c.cluster.writerGeneration() {
+		c.dropStaleWriter()
+	}
 
 	var err error
 	if c.writerConn == nil {
-		c.driver.debugf("opening writer connection to: %s", c.writerDSN)
-		pc, err := c.driver.proxiedDriver.Open(c.writerDSN)
+		if c.driver.degradedProbe > 0 && c.cluster.isDegraded() {
+			return nil, ErrWriterUnavailable
+		}
+
+		c.writerGen = c.cluster.writerGeneration()
+		w := c.cluster.writer()
+		c.driver.debugf("opening writer connection to: %s", w)
+		pc, err := c.driver.openWriter(ctx, w)
+		if err != nil && c.driver.failover != nil {
+			c.driver.debugf("writer unavailable; searching for primary: %s", err)
+			w, pc, err = c.driver.findPrimary(ctx, c.cluster, w)
+		}
+		if err != nil && c.driver.degradedProbe > 0 {
+			c.driver.degrade(c.cluster, err)
+			return nil, ErrWriterUnavailable
+		}
 		if err != nil {
 			return nil, err
 		}
-		c.writerConn = &proxiedConn{Conn: pc, role: "writer"}
+		c.writerConn = &proxiedConn{Conn: pc, role: roleWriter, dsn: w.DSN, cluster: c.cluster}
+		c.driver.stats.connOpened(c.writerConn)
+		if err := c.replay(ctx, c.writerConn); err != nil {
+			c.closeConn(c.writerConn)
+			c.writerConn = nil
+			return nil, err
+		}
 		return c.writerConn, nil
 	}
 	return c.writerConn, err
 }
 
-func (c *conn) reader(ctx context.Context) (*proxiedConn, error) {
+// reader provides the reader connection for an operation (see Fallback.Op), selecting a reader if necessary
+func (c *conn) reader(ctx context.Context, op string) (*proxiedConn, error) {
 	if c.tx != nil {
 		return c.tx.driverConn, nil
 	}
+	if c.shardConns != nil {
+		s, err := c.shard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.reader(ctx, op)
+	}
+
+	// session-scoped state is only on the writer
+	if c.pinned(ctx) {
+		c.driver.debugf("pinned to writer for %s", op)
+		return c.writer(ctx)
+	}
+
+	if c.readerConn != nil && c.readerGen != c.cluster.readerGeneration() {
+		c.dropStaleReader()
+	}
+
+	// reads of another reader group, or with an affinity key, select their reader rather than using the current one
+	group := ReaderGroup(ctx)
+	if _, ok := AffinityKey(ctx); c.readerConn != nil && (ok || group != c.readerGroup) {
+		if c.readerConn.role == roleReader {
+			c.idle(c.readerConn)
+			defer c.closeIdleReaders(c.readerConn)
+			c.readerConn = nil
+		} else if group != c.readerGroup {
+			c.readerConn = nil
+			c.fallback = nil
+		}
+	}
+
+	// a writer substituted for an unavailable reader may not be permitted for this operation
+	if c.readerConn != nil && c.fallback != nil {
+		f := *c.fallback
+		f.Op = op
+		if !c.driver.fallback(f) {
+			return nil, f.Err
+		}
+	}
 
 	var err error
 	if c.readerConn == nil {
+		c.readerGen = c.cluster.readerGeneration()
+		c.readerGroup = group
+		rt := &routing{driver: c.driver}
+		readers, err := c.cluster.readers(rt, group)
+
 		// if there's no readers, signal the caller to use a writer instead
-		if len(c.readerDSNs) == 0 {
-			c.driver.debugf("no readers specified; substituting with writer")
+		if len(readers) == 0 && err == nil {
 			c.readerConn, err = c.writer(ctx)
 			return c.readerConn, err
 		}
 
 		// pick a reader
-		c.driver.debugf("selecting reader connection from: [ %s ]", strings.Join(c.readerDSNs, "; "))
-		pc, err := c.driver.selector(ctx, c.driver.proxiedDriver, c.readerDSNs)
+		var pc *proxiedConn
+		if err == nil {
+			pc, err = c.selectReader(ctx, rt, readers)
+		}
 		if err != nil {
-			// fall back to signalling the caller to use a writer instead
-			c.driver.debugf("no readers available; substituting with writer: %s", err)
-			c.readerConn, err = c.writer(ctx)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			// fall back to signalling the caller to use a writer instead, if permitted
+			f := Fallback{Op: op, Err: err, Stale: err == ErrReadersStale}
+			if !rt.fallBack(f) {
+				return nil, err
+			}
+			if c.readerConn, err = c.writer(ctx); err == nil {
+				c.fallback = &f
+			}
 			return c.readerConn, err
 		}
-		c.readerConn = &proxiedConn{Conn: pc, role: "reader"}
+		c.readerConn = pc
 	}
 	return c.readerConn, err
 }
 
+// selectReader opens a reader connection with the ReaderSelector, retrying with readers not yet tried as configured by WithReaderRetry
+func (c *conn) selectReader(ctx context.Context, rt *routing, readers []string) (*proxiedConn, error) {
+	backoff := c.driver.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		rt.step("selecting reader connection from: [ %s ]", strings.Join(readers, "; "))
+		d := &dialer{Driver: c.driver.proxiedDriver, allow: c.driver.allow, dialed: c.driver.dialed, conns: c.driver.stats.readerConnCount,
+			nodes: c.cluster.reader, idle: c.idleReader}
+		pc, err := c.driver.pick(ctx, d, readers)
+		if err == nil {
+			return c.selected(ctx, pc, d.dsn)
+		}
+		if attempt >= c.driver.retry.Attempts || d.dsn == "" {
+			return nil, err
+		}
+
+		untried := make([]string, 0, len(readers))
+		for _, dsn := range readers {
+			if dsn != d.dsn {
+				untried = append(untried, dsn)
+			}
+		}
+		if len(untried) == 0 {
+			return nil, err
+		}
+		readers = untried
+
+		rt.step("reader unavailable; retrying with another reader in %s: %s", backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// idle keeps a reader connection, no longer the current reader connection, for reuse
+func (c *conn) idle(pc *proxiedConn) {
+	if c.idleReaders == nil {
+		c.idleReaders = map[string]*proxiedConn{}
+	}
+	c.idleReaders[pc.dsn] = pc
+}
+
+// closeIdleReaders closes idle reader connections, other than keep, once another reader has been selected, so that a connection holds
+// at most three delegate connections to readers: the current, hedge and idle reader connections
+func (c *conn) closeIdleReaders(keep *proxiedConn) {
+	for dsn, pc := range c.idleReaders {
+		if pc == keep || len(c.idleReaders) <= 1 {
+			continue
+		}
+		c.driver.debugf("closing idle reader: %s", dsn)
+		if err := c.closeConn(pc); err != nil {
+			c.driver.debugf("failed to close idle reader: %s", err)
+		}
+		delete(c.idleReaders, dsn)
+	}
+}
+
+// idleReader provides the delegate connection of an idle reader connection, if there is one, for the ReaderSelector to reuse
+func (c *conn) idleReader(dsn string) driver.Conn {
+	if pc := c.idleReaders[dsn]; pc != nil {
+		return pc.Conn
+	}
+	return nil
+}
+
+// selected provides the reader connection for a delegate connection provided by the ReaderSelector, which is either reused from an
+// idle reader connection, or newly opened and has the session settings replayed on it
+func (c *conn) selected(ctx context.Context, dc driver.Conn, dsn string) (*proxiedConn, error) {
+	if pc := c.idleReaders[dsn]; pc != nil && pc.Conn == dc {
+		delete(c.idleReaders, dsn)
+		return pc, nil
+	}
+	n, _ := c.cluster.reader(dsn)
+	pc := &proxiedConn{Conn: dc, role: roleReader, dsn: dsn, group: n.group(), cluster: c.cluster}
+	c.driver.stats.connOpened(pc)
+	if err := c.replay(ctx, pc); err != nil {
+		c.closeConn(pc)
+		return nil, err
+	}
+	return pc, nil
+}
+
+// dropStaleReader closes the reader connection if its reader has been removed from the cluster or drained, or discards a substituted
+// writer, so that a reader may be selected from the cluster's current readers
+func (c *conn) dropStaleReader() {
+	if c.hedgeConn != nil && !c.cluster.selectable(c.hedgeConn.dsn) {
+		c.driver.debugf("reader removed from cluster or drained; closing: %s", c.hedgeConn.dsn)
+		if err := c.closeConn(c.hedgeConn); err != nil {
+			c.driver.debugf("failed to close removed reader: %s", err)
+		}
+		c.hedgeConn = nil
+	}
+	for dsn, pc := range c.idleReaders {
+		if !c.cluster.selectable(dsn) {
+			c.driver.debugf("reader removed from cluster or drained; closing: %s", dsn)
+			if err := c.closeConn(pc); err != nil {
+				c.driver.debugf("failed to close removed reader: %s", err)
+			}
+			delete(c.idleReaders, dsn)
+		}
+	}
+	if c.readerConn.role == roleReader && c.cluster.selectable(c.readerConn.dsn) {
+		c.readerGen = c.cluster.readerGeneration()
+		return
+	}
+
+	if c.readerConn != c.writerConn {
+		c.driver.debugf("reader removed from cluster or drained; closing: %s", c.readerConn.dsn)
+		if err := c.closeConn(c.readerConn); err != nil {
+			c.driver.debugf("failed to close removed reader: %s", err)
+		}
+	}
+	c.readerConn = nil
+	c.fallback = nil
+}
+
+// dropStaleWriter closes the writer connection if the cluster's writer has been replaced, along with any reader connection substituted
+// by it
+func (c *conn) dropStaleWriter() {
+	if c.writerConn.dsn == c.cluster.writer().DSN {
+		c.writerGen = c.cluster.writerGeneration()
+		return
+	}
+
+	c.driver.debugf("writer replaced; closing: %s", c.writerConn.dsn)
+	if err := c.closeConn(c.writerConn); err != nil {
+		c.driver.debugf("failed to close replaced writer: %s", err)
+	}
+	if c.readerConn == c.writerConn {
+		c.readerConn = nil
+		c.fallback = nil
+	}
+	c.writerConn = nil
+}
+
+func (c *conn) closeConn(pc *proxiedConn) error {
+	err := pc.Close()
+	pc.closed = true
+	c.driver.stats.connClosed(pc)
+	c.driver.released(pc)
+	return err
+}
+
+// ResetSession closes any connections to a writer or reader removed from (or drained in) the cluster, while the connection is idle,
+// releases any pin of reads to the writer, and resets the delegate connections' sessions where supported
+func (c *conn) ResetSession(ctx context.Context) error {
+	for _, s := range c.shardConns {
+		if err := s.ResetSession(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.writerConn != nil && c.writerGen != c.cluster.writerGeneration() {
+		c.dropStaleWriter()
+	}
+	if c.readerConn != nil && c.readerGen != c.cluster.readerGeneration() {
+		c.dropStaleReader()
+	}
+	c.unpin(c.writerConn)
+
+	if err := resetSession(ctx, c.writerConn); err != nil {
+		return err
+	}
+	if c.readerConn != c.writerConn {
+		if err := resetSession(ctx, c.readerConn); err != nil {
+			return err
+		}
+	}
+	for _, pc := range c.idleReaders {
+		if err := resetSession(ctx, pc); err != nil {
+			return err
+		}
+	}
+	return resetSession(ctx, c.hedgeConn)
+}
+
 // Prepare returns a lazily prepared statement, not yet bound to an underlying connection
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
 	c.driver.debugf("preparing: %s", query)
@@ -99,16 +379,34 @@ func (c *conn) Close() error {
 	errs := []error{}
 	if c.writerConn != nil {
 		c.driver.debugf("closing writer")
-		if err := c.writerConn.Close(); err != nil {
+		if err := c.closeConn(c.writerConn); err != nil {
 			errs = append(errs, err)
 		}
 	}
 	if c.readerConn != nil && c.readerConn != c.writerConn {
 		c.driver.debugf("closing reader")
-		if err := c.readerConn.Close(); err != nil {
+		if err := c.closeConn(c.readerConn); err != nil {
 			errs = append(errs, err)
 		}
 	}
+	if c.hedgeConn != nil {
+		c.driver.debugf("closing hedge reader")
+		if err := c.closeConn(c.hedgeConn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for dsn, pc := range c.idleReaders {
+		c.driver.debugf("closing idle reader: %s", dsn)
+		if err := c.closeConn(pc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, s := range c.shardConns {
+		c.driver.debugf("closing shard: %s", name)
+		if err := s.Close(); err != nil {
+			errs = append(errs, err.(ConnCloseError).errors...)
+		}
+	}
 
 	if len(errs) > 0 {
 		return ConnCloseError{errors: errs}
@@ -134,6 +432,8 @@ func (c *conn) Begin() (driver.Tx, error) {
 		return nil, err
 	}
 	c.tx = &tx{conn: c, driverConn: w, proxiedTx: wtx}
+	c.driver.stats.txBegun(w)
+	c.driver.decided("begin", w)
 	return c.tx, nil
 }
 
@@ -146,16 +446,20 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 	}
 
 	// read only transactions can be sent to a reader
-	if opts.ReadOnly {
-		c.driver.debugf("begin readonly transaction; using reader")
-		r, err := c.reader(ctx)
-		if err == nil {
-			if err := c.beginTx(ctx, r, opts); err == nil {
-				// transacting on the reader
-				return c.tx, nil
-			}
+	rt := &routing{driver: c.driver}
+	if routeRole(rt, false, &opts) == roleReader {
+		r, err := c.reader(ctx, opBegin)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.beginTx(ctx, r, opts); err == nil {
+			// transacting on the reader
+			return c.tx, nil
+		}
+		// if the reader transaction setup fails, fall back to the writer, if permitted
+		if r.role == roleReader && !rt.fallBack(Fallback{Op: opBegin, Err: err}) {
+			return nil, err
 		}
-		// if any part of the reader transaction setup fails, fall back to the writer
 	}
 
 	// by default, force transactions to the writer
@@ -182,6 +486,8 @@ func (c *conn) beginTx(ctx context.Context, pc *proxiedConn, opts driver.TxOptio
 		}
 		// no errors, use the reader transaction
 		c.tx = &tx{conn: c, driverConn: pc, proxiedTx: dtx}
+		c.driver.stats.txBegun(pc)
+		c.driver.decided("begin", pc)
 		return nil
 	}
 	return ErrConnBeginTxUnsupported
@@ -190,6 +496,7 @@ func (c *conn) beginTx(ctx context.Context, pc *proxiedConn, opts driver.TxOptio
 func (c *conn) closeTx(closed *tx) error {
 	if c.tx == closed {
 		c.tx = nil
+		c.driver.stats.txClosed(closed.driverConn)
 		return nil
 	}
 	c.driver.debugf("closed tx mismatch: expected %v; got %v", c.tx, closed)
@@ -216,7 +523,11 @@ func (c *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
 		return nil, err
 	}
 	if e, ok := w.Conn.(driver.Execer); ok {
-		return e.Exec(query, args)
+		c.driver.decided("exec", w)
+		res, err := c.driver.observe(w, pathConn, query, true).withValues(args).result(e.Exec(query, args))
+		c.driver.writeFailed(context.Background(), w, err)
+		c.executed(context.Background(), w, query, valuesToNamedValues(args), err)
+		return res, err
 	}
 	return nil, driver.ErrSkip
 }
@@ -229,27 +540,41 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 		return nil, err
 	}
 	if e, ok := w.Conn.(driver.ExecerContext); ok {
-		return e.ExecContext(ctx, query, args)
+		c.driver.decided("exec", w)
+		res, err := c.driver.observe(w, pathConn, query, true).withNamedValues(args).result(e.ExecContext(ctx, query, args))
+		c.driver.writeFailed(ctx, w, err)
+		c.executed(ctx, w, query, args, err)
+		return res, err
 	}
 	return nil, driver.ErrSkip
 }
 
 // Ping forces writer and reader connections to be established and verified
+//
+// In degraded mode, only the reader connection is verified.
 func (c *conn) Ping(ctx context.Context) error {
+	if c.shardConns != nil {
+		return c.pingShards(ctx)
+	}
+
 	// Ping all subconnections (so they can be reconnected if necessary)
 	w, err := c.writer(ctx)
-	if err != nil {
-		return err
-	}
-	if err := ping(ctx, w); err != nil {
+	switch {
+	case err == ErrWriterUnavailable:
+		c.driver.debugf("writer unavailable; pinging reader only")
+	case err != nil:
 		return err
+	default:
+		if err := ping(ctx, w); err != nil {
+			return err
+		}
 	}
 
-	r, err := c.reader(ctx)
+	r, err := c.reader(ctx, opPing)
 	if err != nil {
 		return err
 	}
-	if c.readerConn != c.writerConn {
+	if r != w {
 		// only ping the reader if it's a different connection to the writer
 		if err := ping(ctx, r); err != nil {
 			return err
@@ -261,12 +586,16 @@ func (c *conn) Ping(ctx context.Context) error {
 // Query attempts to fast-path conn.Query() against the reader
 func (c *conn) Query(query string, args []driver.Value) (driver.Rows, error) {
 	// Query always goes to the reader
-	w, err := c.reader(context.Background())
+	w, err := c.reader(pinning(hinted(context.Background(), query), query), opQuery)
 	if err != nil {
 		return nil, err
 	}
 	if e, ok := w.Conn.(driver.Queryer); ok {
-		return e.Query(query, args)
+		c.driver.decided("query", w)
+		o := c.driver.observe(w, pathConn, query, false).withValues(args)
+		rows, err := e.Query(query, args)
+		c.pin(w, query, err)
+		return o.rows(rows, err)
 	}
 	return nil, driver.ErrSkip
 }
@@ -274,16 +603,42 @@ func (c *conn) Query(query string, args []driver.Value) (driver.Rows, error) {
 // QueryContext attempts to fast-path conn.QueryContext() against the reader
 func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
 	// Query always goes to the reader
-	w, err := c.reader(ctx)
+	ctx = pinning(hinted(ctx, query), query)
+	w, err := c.reader(ctx, opQuery)
 	if err != nil {
 		return nil, err
 	}
 	if e, ok := w.Conn.(driver.QueryerContext); ok {
-		return e.QueryContext(ctx, query, args)
+		if c.driver.hedgeDelay > 0 && c.tx == nil && w.role == roleReader {
+			s := c
+			if c.shardConns != nil {
+				// the shard was resolved for the reader
+				s, _ = c.shard(ctx)
+			}
+			o := c.driver.observe(w, pathConn, query, false).withNamedValues(args)
+			rows, pc, err := s.hedgedQuery(ctx, w, query, args)
+			c.driver.decided("query", pc)
+			return o.on(pc).rows(rows, err)
+		}
+		c.driver.decided("query", w)
+		o := c.driver.observe(w, pathConn, query, false).withNamedValues(args)
+		rows, err := e.QueryContext(ctx, query, args)
+		c.pin(w, query, err)
+		return o.rows(rows, err)
 	}
 	return nil, driver.ErrSkip
 }
 
+func resetSession(ctx context.Context, pc *proxiedConn) error {
+	if pc == nil {
+		return nil
+	}
+	if r, ok := pc.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
 func ping(ctx context.Context, conn driver.Conn) error {
 	if p, ok := conn.(driver.Pinger); ok {
 		return p.Ping(ctx)
@@ -0,0 +1,48 @@
+package rwproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWriterUnavailable is provided for writes while a cluster is in degraded mode, as its writer could not be opened
+var ErrWriterUnavailable = errors.New("rwproxy: writer unavailable; cluster is in degraded mode")
+
+// defaultProbeInterval is the interval at which a degraded writer is probed, when none is specified
+const defaultProbeInterval = 5 * time.Second
+
+// degrade puts a cluster into degraded mode, after its writer failed to open
+func (d *Driver) degrade(cl *cluster, err error) {
+	if cl.setDegraded(true) {
+		d.debugf("writer unavailable; entering degraded mode: %s", err)
+	}
+}
+
+// probeWriters attempts to open the writer of each degraded cluster, restoring normal mode if it can be opened
+func (d *Driver) probeWriters() {
+	for _, cl := range d.openedClusters() {
+		if cl.isDegraded() {
+			d.probeWriter(cl)
+		}
+	}
+}
+
+func (d *Driver) probeWriter(cl *cluster) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.degradedProbe)
+	defer cancel()
+
+	w := cl.writer()
+	pc, err := d.openWriter(ctx, w)
+	if err != nil && d.failover != nil {
+		w, pc, err = d.findPrimary(ctx, cl, w)
+	}
+	if err != nil {
+		d.debugf("writer still unavailable: %s", err)
+		return
+	}
+	pc.Close()
+
+	cl.setDegraded(false)
+	d.debugf("writer recovered; leaving degraded mode: %s", w)
+}
@@ -0,0 +1,54 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithDegradedMode(t *testing.T) {
+	rs := &replicaSet{primary: "writer", down: "writer"}
+	d := rwproxy.New(rs, rwproxy.WithDegradedMode(10*time.Millisecond))
+	defer d.Close()
+	sql.Register(t.Name(), d)
+
+	db, err := sql.Open(t.Name(), "writer;reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !d.Topology().Clusters[0].Degraded {
+		t.Errorf("expected cluster to be degraded")
+	}
+	if _, err := db.Exec("UPDATE"); err != rwproxy.ErrWriterUnavailable {
+		t.Errorf("expected ErrWriterUnavailable; got %v", err)
+	}
+	if _, err := db.BeginTx(context.Background(), nil); err != rwproxy.ErrWriterUnavailable {
+		t.Errorf("expected ErrWriterUnavailable; got %v", err)
+	}
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+
+	rs.setDown("")
+	deadline := time.Now().Add(time.Second)
+	for d.Topology().Clusters[0].Degraded {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected cluster to recover from degraded mode")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := db.Exec("UPDATE"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -19,6 +19,82 @@ The cluster is specified as a "compound" DSN to sql.Open(). The compound DSN is
 The first DSN is used as the "writer", and any subsequent DSNs as a series of "readers" across which queries will be load balanced.
 If no readers are specified, all queries will be sent to the writer, which should behave identically to not using rwproxy at all.
 
+Where delegate DSNs may contain semicolons, or nodes need names or metadata, a structured compound DSN may be used instead. It is a JSON object,
+detected automatically by sql.Open(), and built with MakeStructuredDSN:
+
+	dsn := rwproxy.MakeStructuredDSN(
+		rwproxy.Node{Name: "primary", DSN: "server=primary;database=app"},
+		rwproxy.Node{Name: "replica-1", DSN: "server=replica-1;database=app", Zone: "us-east-1a", Weight: 2},
+	)
+	// {"writer":{"name":"primary","dsn":"server=primary;database=app"},"readers":[{"name":"replica-1",…}]}
+
+Alternatively, the cluster may be loaded from a configuration file in the structured compound DSN format, which is watched for changes so that
+readers can be added and removed without a redeploy:
+
+	sql.Register("mysqlrw", rwproxy.New(mysql.MySQLDriver{}, rwproxy.WithConfigFile("/etc/app/cluster.json", 10*time.Second)))
+
+The topology of opened clusters may also be changed at runtime with Driver.AddReader, RemoveReader, DrainReader (e.g. before maintenance of a
+replica) and SetWriter, given the compound DSN of the cluster to change for AddReader and SetWriter. Connections to removed or drained nodes
+are closed when next used or reset by the connection pool, rather than while in use, so connections idle in the pool hold them open until
+then (see sql.DB.SetConnMaxLifetime).
+
+Structured compound DSNs may also list writer "candidates". With WithWriterFailover, writer connections are checked with a PrimaryDetector
+(MySQLPrimaryDetector or PostgresPrimaryDetector) as they are opened, and when writes fail because the writer has become read-only, so that
+the candidate promoted by a failover becomes the writer without a restart:
+
+	sql.Register("mysqlrw", rwproxy.New(mysql.MySQLDriver{}, rwproxy.WithWriterFailover(rwproxy.MySQLPrimaryDetector, rwproxy.MySQLReadOnlyError)))
+
+With WithDegradedMode, a cluster whose writer can't be opened keeps serving reads: writes fail fast with ErrWriterUnavailable (e.g. to be
+mapped to a 503), Ping succeeds if the reader is healthy, and normal mode is restored once a background probe can open the writer.
+
+WithCircuitBreaker stops repeatedly dialing dead nodes: once a node has failed enough consecutive times its circuit opens, and it is skipped
+(without the latency of a connection timeout) until a background probe succeeds.
+
+WithReaderRetry tries up to a number of distinct readers (with backoff) when the selected reader can't be opened, before substituting the
+writer.
+
+Whether the writer is substituted when no reader is available is decided by a FallbackPolicy: FallbackAlways (the default), FallbackNever
+(e.g. for analytics that shouldn't load the writer), FallbackTransactions, FallbackStale or a custom func, provided with WithFallbackPolicy.
+WithLagProbe (with MySQLLagProbe or PostgresLagProbe) measures each reader's replication lag in the background, and stops lagging readers
+from being selected until they catch up.
+
+WithHedgedReads protects latency-critical queries from a slow reader: if a query hasn't responded within a delay, it is repeated on a
+second reader, and whichever responds first is used while the other is cancelled.
+
+Readers are selected round robin by default. WithLatencyReaderSelector instead prefers readers with a lower moving average of query
+latency and error rate, choosing the better of two random readers to avoid herding onto the fastest. LeastConnectionsReaderSelector
+selects the reader with the fewest delegate connections open from the process, keeping connections balanced once a reader restarts.
+ZoneReaderSelector prefers readers in the local zone (given, or from the RWPROXY_ZONE environment variable) according to each
+Node's Zone, only selecting readers in other zones when local readers are unavailable or over capacity.
+
+ConsistentHashReaderSelector keeps reads for the same key (e.g. a tenant) on the same reader, for better buffer pool locality, by
+consistently hashing the key of each read's context onto the readers:
+
+	rows, err := db.QueryContext(rwproxy.WithAffinityKey(ctx, tenantID), "SELECT ...")
+
+Reads with an affinity key select their reader per query rather than once per connection, reusing any delegate connection to it.
+
+Strategies needing feedback implement Balancer, provided with WithBalancer: rwproxy opens the reader it picks, and reports the latency
+and outcome of each query against a reader, and the closure of each delegate connection to one. A ReaderSelector is a strategy without
+feedback.
+
+Readers may be divided into named groups by Node.Group, e.g. to keep an analytics replica from ordinary reads, which use the "default"
+group. Reads (including read-only transactions) use another group's readers when their context has one:
+
+	rows, err := db.QueryContext(rwproxy.WithReaderGroup(ctx, "analytics"), "SELECT ...")
+
+or when their query leads with a hint comment containing rwproxy:group=analytics.
+
+Each group may have its own Balancer or ReaderSelector, provided with WithReaderGroupBalancer or WithReaderGroupSelector.
+
+Tables sharded across several clusters can share one *sql.DB with WithShards, routing each statement and transaction to the compound DSN of
+the shard resolved from its context (by default, the shard named by its ShardKey), and splitting reads from writes within the shard:
+
+	sql.Register("mysqlrw", rwproxy.New(mysql.MySQLDriver{}, rwproxy.WithShards(map[string]string{"eu": euDSN, "us": usDSN}, nil)))
+	res, err := db.ExecContext(rwproxy.WithShardKey(ctx, "eu"), "UPDATE ...")
+
+Driver.AddReader and SetWriter change a single shard, given its name. A ReaderSource can't be used with WithShards.
+
 Routing
 
 rwproxy selects the most appropriate connection as follows:
@@ -34,12 +110,36 @@ rwproxy selects the most appropriate connection as follows:
 		Query -> reader
 	}
 
-The rwproxy *sql.Conn lazily connects to the writer and a single reader as necessary, and will retain these until the it is closed by the connection pool.
+The rwproxy *sql.Conn lazily connects to the writer and a reader as necessary, and will retain these until the it is closed by the connection pool.
+Reads with an affinity key or of another reader group, and hedged reads, may connect to further readers (see Connection Pooling).
+
+Session settings executed outside a transaction (e.g. SET time_zone = ..., SET search_path ... or SET NAMES ...) are applied to every delegate
+connection of the rwproxy connection, and replayed on any opened later, so that reads run with the same settings as writes. Settings a
+reader rejects (e.g. privileged settings such as sql_log_bin) are skipped on it. Global, transaction and user variables are not session
+settings, though MySQL's SET LOCAL (a synonym for SET SESSION) is.
+
+Session-scoped state that only exists on the writer (temporary tables, LOCK TABLES, GET_LOCK, PostgreSQL advisory locks and user variables)
+pins the rwproxy connection's reads to the writer until the state is released (e.g. by DROP TEMPORARY TABLE, UNLOCK TABLES or RELEASE_LOCK)
+or the session is reset by the connection pool. Reads acquiring or releasing such state, such as SELECT GET_LOCK(...), are run on the
+writer, and locks acquired more than once are held until released as many times. Pinned connections are counted by Stats.PinnedConns and
+Stats.Pins.
 
 Connection Pooling
 
 Package "database/sql" provides a builtin connection pool when sql.Open() is used. Because the pooling happens at a level above (and therefore out of control of) the rwproxy driver,
-it is the rwproxy connections (not the delegated connections) that are pooled. This means that, at worst, rwproxy will hold open both a writer and reader connection for each item
+it is the rwproxy connections (not the delegated connections) that are pooled. This means that rwproxy will hold open both a writer and reader connection for each item
 in the connection pool.
+
+At worst, each item holds a writer connection and three reader connections (and as many again for each shard used, with WithShards): the
+current reader, a second reader for hedged reads (see WithHedgedReads), and the last reader switched away from by reads with an affinity
+key or of another reader group, kept for reuse. Any reader connection it replaces is closed.
+
+Inspection
+
+Driver.Stats() reports the delegate connections held open per DSN, transactions and prepared statements in progress, and cumulative routing counts.
+Driver.Topology() additionally describes each cluster's health and the most recent routing decisions, and is rendered as HTML or JSON by the
+httpdebug subpackage:
+
+	http.Handle("/debug/rwproxy", httpdebug.Handler(d))
 */
 package rwproxy
@@ -5,9 +5,13 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 )
 
 // IncompleteDSNError indicates that the compound DSN is incomplete, and cannot be used
+//
+// With a DSNValidator (see WithDSNValidator), a DSNError with a Reason of ErrEmptyWriter is provided instead.
 type IncompleteDSNError struct {
 	DSN string
 }
@@ -16,9 +20,67 @@ func (e IncompleteDSNError) Error() string {
 	return fmt.Sprintf("rwproxy: combination DSN is incomplete: %#v", e.DSN)
 }
 
+const (
+	roleWriter = "writer"
+	roleReader = "reader"
+)
+
 type proxiedConn struct {
 	driver.Conn
-	role string
+	role   string
+	dsn    string
+	closed bool
+	// group is the reader group of a reader
+	group string
+	// cluster is the cluster of the node
+	cluster *cluster
+	// pins are the session-scoped states held by a writer, and the number of times each was acquired, pinning reads to it (see
+	// sessionState)
+	pins map[string]int
+}
+
+// dialer is the driver.Driver provided to a ReaderSelector, recording the DSN that it opens
+type dialer struct {
+	driver.Driver
+	allow  func(dsn string) error
+	dialed func(dsn string, err error)
+	conns  func(dsn string) int
+	nodes  func(dsn string) (Node, bool)
+	idle   func(dsn string) driver.Conn
+	dsn    string
+	// conn is the connection opened by a ReaderSelector
+	conn driver.Conn
+}
+
+// ConnCounter is implemented by the driver.Driver provided to a ReaderSelector, reporting the number of delegate connections open to a
+// reader from this process
+type ConnCounter interface {
+	OpenConns(dsn string) int
+}
+
+func (d *dialer) Open(name string) (driver.Conn, error) {
+	d.dsn = name
+	// reuse an open connection to the reader, where the rwproxy connection has one
+	if d.conn = d.idle(name); d.conn != nil {
+		return d.conn, nil
+	}
+	if err := d.allow(name); err != nil {
+		return nil, err
+	}
+	c, err := d.Driver.Open(name)
+	d.dialed(name, err)
+	d.conn = c
+	return c, err
+}
+
+// OpenConns implements ConnCounter
+func (d *dialer) OpenConns(dsn string) int {
+	return d.conns(dsn)
+}
+
+// LookupNode implements NodeLookup
+func (d *dialer) LookupNode(dsn string) (Node, bool) {
+	return d.nodes(dsn)
 }
 
 // ReaderSelector implements a read distribution strategy
@@ -30,35 +92,135 @@ type Log func(string)
 // Driver is a "database/sql/driver".Driver implemntation that distributes reads/writes
 type Driver struct {
 	proxiedDriver driver.Driver
-	writerDSN     string
-	readerDSNs    []string
-	selector      ReaderSelector
+	balancer      Balancer
 	logFunc       Log
+	validator     DSNValidator
+	observers     []observer
+	stats         *stats
+
+	config         *configFile
+	configDecoders map[string]ConfigDecoder
+	readerSource   *readerSource
+	failover       *failover
+	degradedProbe  time.Duration
+	breakers       *breakers
+	retry          ReaderRetry
+	fallback       FallbackPolicy
+	lagProbes      *lagProbes
+	hedgeDelay     time.Duration
+	// groupBalancers are the Balancers of the reader groups with their own
+	groupBalancers map[string]Balancer
+	// feedback reports whether any Balancer is reported the use of its readers
+	feedback bool
+	shards   *shards
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu           sync.Mutex
+	clusters     map[string]*cluster
+	clusterOrder []*cluster
+	dialErrs     map[string]error
+	decisions    []Decision
+	nextDecision int
 }
 
 // New wraps a lower level delegate "database/sql/driver".Driver with an rwproxy driver
 func New(delegate driver.Driver, opts ...Option) *Driver {
-	d := &Driver{proxiedDriver: delegate}
+	d := &Driver{
+		proxiedDriver: delegate,
+		stats:         newStats(),
+		clusters:      map[string]*cluster{},
+		dialErrs:      map[string]error{},
+		decisions:     make([]Decision, maxDecisions),
+
+		configDecoders: map[string]ConfigDecoder{".json": decodeJSONConfig},
+		closed:         make(chan struct{}),
+	}
 	for _, o := range opts {
 		o(d)
 	}
 
 	// defaults
-	if d.selector == nil {
-		d.selector = RoundRobinReaderSelector()
+	if d.balancer == nil {
+		d.balancer = selectorBalancer{RoundRobinReaderSelector()}
+	}
+	if d.retry.Attempts < 1 {
+		d.retry.Attempts = 1
+	}
+	if d.fallback == nil {
+		d.fallback = FallbackAlways
+	}
+	if d.feedback {
+		d.observers = append(d.observers, balancerObserver)
+	}
+
+	// background activity
+	if d.config != nil {
+		if err := d.reloadConfig(); err != nil {
+			// retried when opened
+			d.debugf("%s", err)
+		}
+		if d.config.interval > 0 {
+			go d.watchConfig()
+		}
+	}
+	if d.readerSource != nil && d.readerSource.interval > 0 {
+		go d.every(d.readerSource.interval, d.refreshReaders)
+	}
+	if d.degradedProbe > 0 {
+		go d.every(d.degradedProbe, d.probeWriters)
+	}
+	if d.breakers != nil {
+		go d.every(d.breakers.ProbeInterval, d.probeBreakers)
+	}
+	if d.lagProbes != nil {
+		go d.watchLag()
 	}
 
 	return d
 }
 
+// Close stops any background activity of the Driver, such as watching a configuration file
+//
+// Connections opened by the Driver are unaffected, and should be closed through "database/sql" as usual.
+func (d *Driver) Close() error {
+	d.closeOnce.Do(func() { close(d.closed) })
+	return nil
+}
+
+// every calls fn at each interval until the Driver is closed
+func (d *Driver) every(interval time.Duration, fn func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-d.closed:
+			return
+		case <-t.C:
+			fn()
+		}
+	}
+}
+
 // Open implements "database/sql/driver".Driver.Open(), taking a compound DSN containing DSNs for writer and reader connections
+//
+// The compound DSN may be either semicolon-separated (see MakeCompoundDSN) or structured (see MakeStructuredDSN), and is detected
+// automatically.
 func (d *Driver) Open(name string) (driver.Conn, error) {
-	wdsn, rdsns := ParseCompoundDSN(name)
-	if wdsn == "" {
-		// no writer provided, can't proceed
-		return nil, IncompleteDSNError{DSN: name}
+	if d.shards != nil {
+		if err := d.openShards(); err != nil {
+			return nil, err
+		}
+		return &conn{driver: d, shardConns: map[string]*conn{}, session: &session{}}, nil
 	}
-	return &conn{driver: d, writerDSN: wdsn, readerDSNs: rdsns}, nil
+
+	cl, err := d.cluster(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{driver: d, cluster: cl, session: &session{}}, nil
 }
 
 // Parent returns the wrapped Driver
@@ -78,6 +240,9 @@ func MakeCompoundDSN(writerDSN string, readerDSNs ...string) string {
 }
 
 // ParseCompoundDSN breaks up a compound DSN into its component DSNs
+//
+// Empty segments are ignored, and an empty writer DSN is returned if there are no DSNs at all. ParseCompoundDSNStrict reports these
+// and other problems instead.
 func ParseCompoundDSN(dsn string) (string, []string) {
 	// lazily break up between semicolons
 	split := strings.Split(dsn, ";")
@@ -87,5 +252,8 @@ func ParseCompoundDSN(dsn string) (string, []string) {
 			dsns = append(dsns, dsn)
 		}
 	}
+	if len(dsns) == 0 {
+		return "", dsns
+	}
 	return dsns[0], dsns[1:]
 }
@@ -359,3 +359,145 @@ func TestStmt_reuse(t *testing.T) {
 		})
 	}
 }
+
+func TestDriver_Stats(t *testing.T) {
+	dname, rwproxyDrv, mockDrv := newRegisteredMockProxy(t, nil, []sqldrivermock.Option{sqldrivermock.ConnBeginTx()})
+	expect := mockDrv.Expect()
+	defer func() {
+		if t.Failed() {
+			t.Log(expect.String())
+		}
+	}()
+
+	exConnW := expect.Open().WithDSN("my-writer")
+	exConnR := expect.Open().WithDSN("my-reader")
+	exConnR.Prepare().WithQuery("SELECT").Query()
+	exConnW.Prepare().WithQuery("UPDATE").Exec()
+	exTx := exConnW.Begin()
+	exTx.Rollback()
+
+	db, err := sql.Open(dname, "my-writer;my-reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testStatements(t, conn)
+
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stats := rwproxyDrv.Stats()
+	if stats.WriterConns["my-writer"] != 1 || len(stats.WriterConns) != 1 {
+		t.Errorf("expected 1 writer connection to my-writer, got %v", stats.WriterConns)
+	}
+	if stats.ReaderConns["my-reader"] != 1 || len(stats.ReaderConns) != 1 {
+		t.Errorf("expected 1 reader connection to my-reader, got %v", stats.ReaderConns)
+	}
+	if stats.WriterTxs != 1 || stats.ReaderTxs != 0 {
+		t.Errorf("expected 1 writer transaction and 0 reader transactions, got %d and %d", stats.WriterTxs, stats.ReaderTxs)
+	}
+	if stats.WriterRoutes != 2 || stats.ReaderRoutes != 1 {
+		t.Errorf("expected 2 writer routes and 1 reader route, got %d and %d", stats.WriterRoutes, stats.ReaderRoutes)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stats := rwproxyDrv.Stats(); stats.WriterTxs != 0 {
+		t.Errorf("expected 0 writer transactions, got %d", stats.WriterTxs)
+	}
+
+	if err := expect.Confirm(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestWithSlowQueryLog(t *testing.T) {
+	var logged []rwproxy.SlowQuery
+	dname, _, mockDrv := newRegisteredMockProxy(t, []rwproxy.Option{
+		rwproxy.WithSlowQueryLog(0, func(sq rwproxy.SlowQuery) { logged = append(logged, sq) }),
+	}, nil)
+	expect := mockDrv.Expect()
+	defer func() {
+		if t.Failed() {
+			t.Log(expect.String())
+		}
+	}()
+
+	expect.Open().WithDSN("user:secret@my-reader").Prepare().WithQuery("SELECT").Query()
+	expect.Open().WithDSN("user:secret@my-writer").Prepare().WithQuery("UPDATE").Exec()
+
+	db, err := sql.Open(dname, "user:secret@my-writer;user:secret@my-reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	testStatements(t, db)
+
+	expected := []rwproxy.SlowQuery{
+		{Query: "SELECT", Role: "reader", DSN: "user:xxxxx@my-reader", Path: "stmt"},
+		{Query: "UPDATE", Role: "writer", DSN: "user:xxxxx@my-writer", Path: "stmt", Exec: true},
+	}
+	if len(logged) != len(expected) {
+		t.Fatalf("expected %d slow queries, got %d: %+v", len(expected), len(logged), logged)
+	}
+	for i, sq := range logged {
+		sq.Duration, sq.RowsDuration = 0, 0
+		if sq != expected[i] {
+			t.Errorf("slow query mismatch: expected %+v; got %+v", expected[i], sq)
+		}
+	}
+
+	if err := expect.Confirm(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestStmt_closeTwice(t *testing.T) {
+	mockDrv := sqldrivermock.New()
+	mockDrv.Expect().Open().WithDSN("my-reader").Prepare().WithQuery("SELECT").Query()
+	rwproxyDrv := rwproxy.New(mockDrv)
+
+	conn, err := rwproxyDrv.Open("my-writer;my-reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	stmt, err := conn.Prepare("SELECT")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows, err := stmt.(driver.StmtQueryContext).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+	if stmts := rwproxyDrv.Stats().Stmts; stmts != 1 {
+		t.Errorf("expected 1 statement, got %d", stmts)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := stmt.Close(); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if stmts := rwproxyDrv.Stats().Stmts; stmts != 0 {
+			t.Errorf("expected 0 statements after close %d, got %d", i+1, stmts)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package rwproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Node is a single writer or reader of a Cluster
+type Node struct {
+	// Name identifies the node; when empty, the DSN is used in its place
+	Name string `json:"name,omitempty"`
+	// DSN is the delegate driver DSN of the node
+	DSN string `json:"dsn"`
+	// Weight is the relative share of reads the node should receive, for selectors that support it
+	Weight int `json:"weight,omitempty"`
+	// Zone is the availability zone or locality of the node
+	Zone string `json:"zone,omitempty"`
+	// Group is the named reader group of a reader (default DefaultReaderGroup), reads of other groups never use it (see WithReaderGroup)
+	Group string `json:"group,omitempty"`
+	// Params are arbitrary per-node options
+	Params map[string]string `json:"params,omitempty"`
+}
+
+func (n Node) String() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return n.DSN
+}
+
+// Cluster is a writer and its readers, as specified by a compound DSN
+type Cluster struct {
+	Writer  Node   `json:"writer"`
+	Readers []Node `json:"readers,omitempty"`
+	// Candidates are nodes which may be promoted to writer, in order of preference; see WithWriterFailover
+	Candidates []Node `json:"candidates,omitempty"`
+}
+
+// StructuredDSNError indicates that a structured compound DSN could not be parsed
+type StructuredDSNError struct {
+	DSN string
+	Err error
+}
+
+func (e StructuredDSNError) Error() string {
+	return fmt.Sprintf("rwproxy: invalid structured DSN %#v: %s", e.DSN, e.Err)
+}
+
+// MakeStructuredDSN combines writer and reader nodes to build a structured compound DSN
+//
+// Structured compound DSNs are JSON objects, and so (unlike the DSNs built by MakeCompoundDSN) may contain delegate DSNs with semicolons,
+// and carry names and metadata for each node:
+//
+//	{"writer":{"name":"primary","dsn":"…"},"readers":[{"name":"replica-1","dsn":"…","zone":"us-east-1a"}]}
+func MakeStructuredDSN(writer Node, readers ...Node) string {
+	return Cluster{Writer: writer, Readers: readers}.StructuredDSN()
+}
+
+// StructuredDSN builds a structured compound DSN for the Cluster, as MakeStructuredDSN, including any writer candidates
+func (c Cluster) StructuredDSN() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		// Nodes contain only strings, ints and string maps, which always marshal
+		panic(err)
+	}
+	return string(b)
+}
+
+// IsStructuredDSN reports whether a compound DSN uses the structured (JSON) syntax, rather than the semicolon-separated syntax
+func IsStructuredDSN(dsn string) bool {
+	return strings.HasPrefix(strings.TrimSpace(dsn), "{")
+}
+
+// ParseCluster parses a compound DSN of either syntax into its nodes
+//
+// Semicolon-separated compound DSNs produce nodes with only a DSN.
+func ParseCluster(dsn string) (Cluster, error) {
+	if !IsStructuredDSN(dsn) {
+		wdsn, rdsns := ParseCompoundDSN(dsn)
+		c := Cluster{Writer: Node{DSN: wdsn}, Readers: make([]Node, len(rdsns))}
+		for i, rdsn := range rdsns {
+			c.Readers[i] = Node{DSN: rdsn}
+		}
+		return c, nil
+	}
+
+	var c Cluster
+	dec := json.NewDecoder(strings.NewReader(dsn))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Cluster{}, StructuredDSNError{DSN: dsn, Err: err}
+	}
+	if dec.More() {
+		return Cluster{}, StructuredDSNError{DSN: dsn, Err: fmt.Errorf("unexpected data after cluster")}
+	}
+	return c, nil
+}
+
+// Reasons for a compound DSN being invalid, provided as DSNError.Reason
+var (
+	ErrEmptyWriter     = errors.New("writer DSN is empty")
+	ErrEmptyReader     = errors.New("reader DSN is empty")
+	ErrDuplicateReader = errors.New("reader DSN is duplicated")
+	ErrReaderIsWriter  = errors.New("reader DSN is the writer DSN")
+	ErrInvalidSegment  = errors.New("DSN is rejected by the DSNValidator")
+	ErrEmptyCandidate  = errors.New("writer candidate DSN is empty")
+	// ErrDuplicateCandidate is provided when a writer candidate is duplicated, or is also the writer or a reader
+	ErrDuplicateCandidate = errors.New("writer candidate DSN is duplicated")
+)
+
+// DSNError indicates that a compound DSN is invalid, describing which node is at fault and why
+type DSNError struct {
+	DSN string
+	// Segment is the index of the offending node: 0 for the writer, 1 onwards for each reader, followed by each writer candidate
+	Segment int
+	// Reason is one of ErrEmptyWriter, ErrEmptyReader, ErrDuplicateReader, ErrReaderIsWriter, ErrEmptyCandidate,
+	// ErrDuplicateCandidate or ErrInvalidSegment
+	Reason error
+	// Err is the error provided by the DSNValidator, for ErrInvalidSegment
+	Err error
+}
+
+func (e DSNError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("rwproxy: invalid compound DSN: segment %d: %s: %s", e.Segment, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("rwproxy: invalid compound DSN: segment %d: %s", e.Segment, e.Reason)
+}
+
+// DSNValidator validates a single delegate DSN, e.g. with the delegate driver's own DSN parser:
+//
+//	func(dsn string) error {
+//		_, err := mysql.ParseDSN(dsn)
+//		return err
+//	}
+type DSNValidator func(dsn string) error
+
+// ParseCompoundDSNStrict breaks up a semicolon-separated compound DSN into its component DSNs, reporting any problems as a DSNError
+//
+// Unlike ParseCompoundDSN, empty segments are errors. Each DSN is validated by validate, which may be nil.
+func ParseCompoundDSNStrict(dsn string, validate DSNValidator) (string, []string, error) {
+	split := strings.Split(dsn, ";")
+	c := Cluster{Writer: Node{DSN: split[0]}, Readers: make([]Node, len(split)-1)}
+	for i, rdsn := range split[1:] {
+		c.Readers[i] = Node{DSN: rdsn}
+	}
+	if err := c.validate(dsn, validate); err != nil {
+		return "", nil, err
+	}
+	return split[0], split[1:], nil
+}
+
+// Validate reports any problems with the Cluster as a DSNError, validating each DSN with validate, which may be nil
+func (c Cluster) Validate(validate DSNValidator) error {
+	return c.validate(c.StructuredDSN(), validate)
+}
+
+func (c Cluster) validate(dsn string, validate DSNValidator) error {
+	if c.Writer.DSN == "" {
+		return DSNError{DSN: dsn, Segment: 0, Reason: ErrEmptyWriter}
+	}
+	if validate != nil {
+		if err := validate(c.Writer.DSN); err != nil {
+			return DSNError{DSN: dsn, Segment: 0, Reason: ErrInvalidSegment, Err: err}
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, r := range c.Readers {
+		segment := i + 1
+		switch {
+		case r.DSN == "":
+			return DSNError{DSN: dsn, Segment: segment, Reason: ErrEmptyReader}
+		case r.DSN == c.Writer.DSN:
+			return DSNError{DSN: dsn, Segment: segment, Reason: ErrReaderIsWriter}
+		case seen[r.DSN]:
+			return DSNError{DSN: dsn, Segment: segment, Reason: ErrDuplicateReader}
+		}
+		seen[r.DSN] = true
+
+		if validate != nil {
+			if err := validate(r.DSN); err != nil {
+				return DSNError{DSN: dsn, Segment: segment, Reason: ErrInvalidSegment, Err: err}
+			}
+		}
+	}
+
+	seen[c.Writer.DSN] = true
+	for i, n := range c.Candidates {
+		segment := len(c.Readers) + i + 1
+		switch {
+		case n.DSN == "":
+			return DSNError{DSN: dsn, Segment: segment, Reason: ErrEmptyCandidate}
+		case seen[n.DSN]:
+			return DSNError{DSN: dsn, Segment: segment, Reason: ErrDuplicateCandidate}
+		}
+		seen[n.DSN] = true
+
+		if validate != nil {
+			if err := validate(n.DSN); err != nil {
+				return DSNError{DSN: dsn, Segment: segment, Reason: ErrInvalidSegment, Err: err}
+			}
+		}
+	}
+	return nil
+}
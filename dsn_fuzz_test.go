@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+package rwproxy_test
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nedscode/rwproxy"
+)
+
+// FuzzStructuredDSN is built separately from the other tests, as fuzzing requires Go 1.18
+func FuzzStructuredDSN(f *testing.F) {
+	f.Add("primary", "user:pass@tcp(w:3306)/db", "replica", "server=r;database=db", "us-east-1a", 1, "key", `va"l;ue`)
+	f.Add("", "w", "", `{"dsn":"r"}`, "", 0, "", "")
+	f.Add("π", "host=w password='a;b'", "\\", "r\n", "\x00", -1, "{", "}")
+
+	f.Fuzz(func(t *testing.T, wname, wdsn, rname, rdsn, zone string, weight int, key, value string) {
+		for _, s := range []string{wname, wdsn, rname, rdsn, zone, key, value} {
+			if !utf8.ValidString(s) {
+				// invalid UTF-8 is coerced to U+FFFD by JSON, so can't round-trip
+				t.Skip()
+			}
+		}
+
+		writer := rwproxy.Node{Name: wname, DSN: wdsn}
+		reader := rwproxy.Node{Name: rname, DSN: rdsn, Weight: weight, Zone: zone, Params: map[string]string{key: value}}
+		dsn := rwproxy.MakeStructuredDSN(writer, reader)
+
+		if !rwproxy.IsStructuredDSN(dsn) {
+			t.Fatalf("expected %#v to be detected as structured", dsn)
+		}
+		cl, err := rwproxy.ParseCluster(dsn)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %#v: %s", dsn, err)
+		}
+		expected := rwproxy.Cluster{Writer: writer, Readers: []rwproxy.Node{reader}}
+		if !reflect.DeepEqual(cl, expected) {
+			t.Errorf("round-trip mismatch: expected %+v; got %+v", expected, cl)
+		}
+	})
+}
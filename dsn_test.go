@@ -0,0 +1,229 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+	"github.com/nedscode/rwproxy/sqldrivermock"
+)
+
+func TestParseCluster(t *testing.T) {
+	cases := []struct {
+		name     string
+		dsn      string
+		expected rwproxy.Cluster
+		err      bool
+	}{
+		{
+			name:     "semicolon-separated",
+			dsn:      "writer;reader-1;reader-2",
+			expected: rwproxy.Cluster{Writer: rwproxy.Node{DSN: "writer"}, Readers: []rwproxy.Node{{DSN: "reader-1"}, {DSN: "reader-2"}}},
+		},
+		{
+			name:     "semicolon-separated without readers",
+			dsn:      "writer",
+			expected: rwproxy.Cluster{Writer: rwproxy.Node{DSN: "writer"}, Readers: []rwproxy.Node{}},
+		},
+		{
+			name: "structured",
+			dsn:  ` {"writer":{"name":"primary","dsn":"server=w;database=db"},"readers":[{"name":"replica","dsn":"server=r;database=db","weight":2,"zone":"a","params":{"k":"v"}}]}`,
+			expected: rwproxy.Cluster{
+				Writer:  rwproxy.Node{Name: "primary", DSN: "server=w;database=db"},
+				Readers: []rwproxy.Node{{Name: "replica", DSN: "server=r;database=db", Weight: 2, Zone: "a", Params: map[string]string{"k": "v"}}},
+			},
+		},
+		{
+			name: "structured with unknown field",
+			dsn:  `{"writer":{"dsn":"w"},"reader":[{"dsn":"r"}]}`,
+			err:  true,
+		},
+		{
+			name: "structured with trailing data",
+			dsn:  `{"writer":{"dsn":"w"}}{}`,
+			err:  true,
+		},
+		{
+			name: "malformed structured",
+			dsn:  `{"writer":`,
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cl, err := rwproxy.ParseCluster(c.dsn)
+			if c.err {
+				if _, ok := err.(rwproxy.StructuredDSNError); !ok {
+					t.Errorf("expected StructuredDSNError, got %#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(cl, c.expected) {
+				t.Errorf("cluster mismatch: expected %+v; got %+v", c.expected, cl)
+			}
+		})
+	}
+}
+
+func TestDriver_structuredDSN(t *testing.T) {
+	dname, _, mockDrv := newRegisteredMockProxy(t, nil, nil)
+	expect := mockDrv.Expect()
+	expect.Open().WithDSN("server=w;database=db")
+	expect.Open().WithDSN("server=r;database=db")
+
+	db, err := sql.Open(dname, rwproxy.MakeStructuredDSN(
+		rwproxy.Node{Name: "primary", DSN: "server=w;database=db"},
+		rwproxy.Node{Name: "replica", DSN: "server=r;database=db"},
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := expect.Confirm(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+		t.Log(expect.String())
+	}
+}
+
+func TestParseCompoundDSN_empty(t *testing.T) {
+	for _, dsn := range []string{"", ";", ";;"} {
+		wdsn, rdsns := rwproxy.ParseCompoundDSN(dsn)
+		if wdsn != "" || len(rdsns) != 0 {
+			t.Errorf("expected no DSNs from %#v, got %#v and %#v", dsn, wdsn, rdsns)
+		}
+	}
+}
+
+func TestParseCompoundDSNStrict(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	validate := func(dsn string) error {
+		if strings.HasPrefix(dsn, "bad") {
+			return errInvalid
+		}
+		return nil
+	}
+
+	cases := []struct {
+		dsn     string
+		segment int
+		reason  error
+	}{
+		{dsn: "writer;reader-1;reader-2"},
+		{dsn: "writer"},
+		{dsn: "", segment: 0, reason: rwproxy.ErrEmptyWriter},
+		{dsn: ";;", segment: 0, reason: rwproxy.ErrEmptyWriter},
+		{dsn: "writer;", segment: 1, reason: rwproxy.ErrEmptyReader},
+		{dsn: "writer;reader;;", segment: 2, reason: rwproxy.ErrEmptyReader},
+		{dsn: "writer;reader;reader", segment: 2, reason: rwproxy.ErrDuplicateReader},
+		{dsn: "writer;reader;writer", segment: 2, reason: rwproxy.ErrReaderIsWriter},
+		{dsn: "bad-writer;reader", segment: 0, reason: rwproxy.ErrInvalidSegment},
+		{dsn: "writer;reader;bad-reader", segment: 2, reason: rwproxy.ErrInvalidSegment},
+	}
+
+	for _, c := range cases {
+		_, _, err := rwproxy.ParseCompoundDSNStrict(c.dsn, validate)
+		if c.reason == nil {
+			if err != nil {
+				t.Errorf("unexpected error for %#v: %s", c.dsn, err)
+			}
+			continue
+		}
+
+		dsnErr, ok := err.(rwproxy.DSNError)
+		if !ok {
+			t.Errorf("expected DSNError for %#v, got %#v", c.dsn, err)
+			continue
+		}
+		if dsnErr.Segment != c.segment || dsnErr.Reason != c.reason {
+			t.Errorf("error mismatch for %#v: expected segment %d: %s; got %s", c.dsn, c.segment, c.reason, err)
+		}
+		if c.reason == rwproxy.ErrInvalidSegment && dsnErr.Err != errInvalid {
+			t.Errorf("expected validator error for %#v, got %#v", c.dsn, dsnErr.Err)
+		}
+	}
+}
+
+func TestCluster_Validate_candidates(t *testing.T) {
+	cases := []struct {
+		candidates []rwproxy.Node
+		segment    int
+		reason     error
+	}{
+		{candidates: []rwproxy.Node{{DSN: "candidate-1"}, {DSN: "candidate-2"}}},
+		{candidates: []rwproxy.Node{{DSN: ""}}, segment: 2, reason: rwproxy.ErrEmptyCandidate},
+		{candidates: []rwproxy.Node{{DSN: "writer"}}, segment: 2, reason: rwproxy.ErrDuplicateCandidate},
+		{candidates: []rwproxy.Node{{DSN: "candidate"}, {DSN: "reader"}}, segment: 3, reason: rwproxy.ErrDuplicateCandidate},
+		{candidates: []rwproxy.Node{{DSN: "candidate"}, {DSN: "candidate"}}, segment: 3, reason: rwproxy.ErrDuplicateCandidate},
+	}
+
+	for _, c := range cases {
+		cl := rwproxy.Cluster{Writer: rwproxy.Node{DSN: "writer"}, Readers: []rwproxy.Node{{DSN: "reader"}}, Candidates: c.candidates}
+		err := cl.Validate(nil)
+		if c.reason == nil {
+			if err != nil {
+				t.Errorf("unexpected error for %v: %s", c.candidates, err)
+			}
+			continue
+		}
+		if dsnErr, ok := err.(rwproxy.DSNError); !ok || dsnErr.Segment != c.segment || dsnErr.Reason != c.reason {
+			t.Errorf("error mismatch for %v: expected segment %d: %s; got %v", c.candidates, c.segment, c.reason, err)
+		}
+	}
+}
+
+func TestWithDSNValidator(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	dname, _, _ := newRegisteredMockProxy(t, []rwproxy.Option{
+		rwproxy.WithDSNValidator(func(dsn string) error {
+			if dsn == "bad-reader" {
+				return errInvalid
+			}
+			return nil
+		}),
+	}, nil)
+
+	for _, dsn := range []string{"", "writer;bad-reader", rwproxy.MakeStructuredDSN(rwproxy.Node{DSN: "writer"}, rwproxy.Node{DSN: "writer"})} {
+		db, err := sql.Open(dname, dsn)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := db.PingContext(context.Background()); err == nil {
+			t.Errorf("expected error opening %#v", dsn)
+		} else if _, ok := err.(rwproxy.DSNError); !ok {
+			t.Errorf("expected DSNError opening %#v, got %#v", dsn, err)
+		}
+		db.Close()
+	}
+}
+
+func TestOpen_lenient(t *testing.T) {
+	d := rwproxy.New(sqldrivermock.New())
+	for _, dsn := range []string{"writer;reader;reader", "writer;writer", "writer;;reader;"} {
+		conn, err := d.Open(dsn)
+		if err != nil {
+			t.Errorf("unexpected error opening %#v: %s", dsn, err)
+			continue
+		}
+		conn.Close()
+	}
+
+	for _, dsn := range []string{"", ";;"} {
+		if _, err := d.Open(dsn); err == nil {
+			t.Errorf("expected error opening %#v", dsn)
+		} else if _, ok := err.(rwproxy.IncompleteDSNError); !ok {
+			t.Errorf("expected IncompleteDSNError opening %#v, got %#v", dsn, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNotPrimary is provided when a writer connection is opened to a node that is not the primary
+var ErrNotPrimary = errors.New("rwproxy: writer is not the primary")
+
+// ErrNoPrimary is provided when neither the writer nor any writer candidate is the primary
+var ErrNoPrimary = errors.New("rwproxy: no writer candidate is the primary")
+
+// PrimaryDetector reports whether a delegate connection is to the primary (i.e. writable) node of a cluster
+type PrimaryDetector func(ctx context.Context, c driver.Conn) (bool, error)
+
+// ReadOnlyErrorFunc reports whether a write failed because the writer is read-only, e.g. having been demoted by a failover
+type ReadOnlyErrorFunc func(err error) bool
+
+// MySQLPrimaryDetector detects a MySQL primary by it being neither read_only nor innodb_read_only
+func MySQLPrimaryDetector(ctx context.Context, c driver.Conn) (bool, error) {
+	_, values, err := queryRow(ctx, c, "SELECT @@read_only, @@innodb_read_only")
+	if err != nil {
+		return false, err
+	}
+	for _, v := range values {
+		readOnly, err := parseBool(v)
+		if err != nil {
+			return false, err
+		}
+		if readOnly {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PostgresPrimaryDetector detects a PostgreSQL primary by it not being in recovery
+func PostgresPrimaryDetector(ctx context.Context, c driver.Conn) (bool, error) {
+	_, values, err := queryRow(ctx, c, "SELECT pg_is_in_recovery()")
+	if err != nil {
+		return false, err
+	}
+	inRecovery, err := parseBool(values[0])
+	if err != nil {
+		return false, err
+	}
+	return !inRecovery, nil
+}
+
+// MySQLReadOnlyError recognises the errors MySQL provides when writing to a read-only server: 1290 (running with --read-only), 1792
+// (read-only transaction) and 1836 (read-only mode)
+func MySQLReadOnlyError(err error) bool {
+	msg := err.Error()
+	for _, code := range []string{"Error 1290", "Error 1792", "Error 1836"} {
+		if strings.Contains(msg, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// PostgresReadOnlyError recognises the error PostgreSQL provides when writing to a server in recovery: SQLSTATE 25006
+// (read_only_sql_transaction)
+func PostgresReadOnlyError(err error) bool {
+	if s, ok := err.(interface{ SQLState() string }); ok {
+		return s.SQLState() == "25006"
+	}
+	return strings.Contains(err.Error(), "read-only transaction")
+}
+
+// failover is the configuration of writer failover
+type failover struct {
+	detect   PrimaryDetector
+	readOnly ReadOnlyErrorFunc
+}
+
+// openWriter opens a writer connection, verifying that it is to the primary when failover is in use
+func (d *Driver) openWriter(ctx context.Context, w Node) (driver.Conn, error) {
+	if err := d.allow(w.DSN); err != nil {
+		return nil, err
+	}
+	pc, err := d.proxiedDriver.Open(w.DSN)
+	d.dialed(w.DSN, err)
+	if err != nil || d.failover == nil {
+		return pc, err
+	}
+
+	primary, err := d.failover.detect(ctx, pc)
+	if err == nil && !primary {
+		err = ErrNotPrimary
+	}
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	return pc, nil
+}
+
+// findPrimary opens a connection to the first writer candidate found to be the primary, promoting it to writer in place of stale
+//
+// If another connection has already replaced the stale writer, the current writer is opened instead.
+func (d *Driver) findPrimary(ctx context.Context, cl *cluster, stale Node) (Node, driver.Conn, error) {
+	cl.failoverMu.Lock()
+	defer cl.failoverMu.Unlock()
+
+	if w := cl.writer(); w.DSN != stale.DSN {
+		d.debugf("writer already replaced; opening: %s", w)
+		pc, err := d.openWriter(ctx, w)
+		return w, pc, err
+	}
+
+	for _, n := range cl.spec().Candidates {
+		pc, err := d.openWriter(ctx, n)
+		if err != nil {
+			d.debugf("writer candidate is not the primary: %s: %s", n, err)
+			continue
+		}
+		d.debugf("promoting writer candidate; connections to %s will be closed when next used: %s", stale, n)
+		cl.promote(n)
+		return n, pc, nil
+	}
+	return stale, nil, ErrNoPrimary
+}
+
+// writeFailed searches for a new primary if a write was rejected because the writer is read-only
+//
+// The error is not retried: connections to the previous writer are closed when next used, and later writes use the promoted writer.
+func (d *Driver) writeFailed(ctx context.Context, pc *proxiedConn, err error) {
+	if err == nil || d.failover == nil || pc.role != roleWriter || !d.failover.readOnly(err) {
+		return
+	}
+	cl := pc.cluster
+	if w := cl.writer(); w.DSN == pc.dsn {
+		d.debugf("write rejected by read-only writer; searching for primary: %s", err)
+		_, c, err := d.findPrimary(ctx, cl, w)
+		if err != nil {
+			d.debugf("failed to find primary: %s", err)
+			return
+		}
+		c.Close()
+	}
+}
+
+// queryRow queries a single row directly from a delegate connection, providing its column names and values
+func queryRow(ctx context.Context, c driver.Conn, query string) ([]string, []driver.Value, error) {
+	var rows driver.Rows
+	err := driver.ErrSkip
+	if q, ok := c.(driver.QueryerContext); ok {
+		rows, err = q.QueryContext(ctx, query, nil)
+	}
+	if err == driver.ErrSkip {
+		var s driver.Stmt
+		if s, err = c.Prepare(query); err != nil {
+			return nil, nil, err
+		}
+		defer s.Close()
+		rows, err = s.Query(nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns := rows.Columns()
+	values := make([]driver.Value, len(columns))
+	if err := rows.Next(values); err != nil {
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("rwproxy: no rows returned by %s", query)
+		}
+		return nil, nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("rwproxy: no columns returned by %s", query)
+	}
+	return columns, values, nil
+}
+
+// parseBool interprets a boolean returned by a delegate driver as an integer, bool or string
+func parseBool(v driver.Value) (bool, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case []byte:
+		return strconv.ParseBool(string(v))
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("rwproxy: unexpected boolean value %#v", v)
+}
@@ -0,0 +1,240 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+// replicaSet is a driver for a fake MySQL replica set, with a single writable primary
+type replicaSet struct {
+	mu      sync.Mutex
+	primary string
+	down    string
+	slow    string
+	// settings are the session settings executed on each node
+	settings map[string][]string
+}
+
+func (rs *replicaSet) setPrimary(dsn string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.primary = dsn
+}
+
+func (rs *replicaSet) isPrimary(dsn string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.primary == dsn
+}
+
+func (rs *replicaSet) setDown(dsn string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.down = dsn
+}
+
+func (rs *replicaSet) setSlow(dsn string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.slow = dsn
+}
+
+func (rs *replicaSet) isSlow(dsn string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.slow == dsn
+}
+
+func (rs *replicaSet) set(dsn, query string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.settings == nil {
+		rs.settings = map[string][]string{}
+	}
+	rs.settings[dsn] = append(rs.settings[dsn], query)
+}
+
+func (rs *replicaSet) settingsOf(dsn string) []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]string(nil), rs.settings[dsn]...)
+}
+
+func (rs *replicaSet) Open(dsn string) (driver.Conn, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.down == dsn {
+		return nil, errors.New("connection refused")
+	}
+	return &replicaConn{rs: rs, dsn: dsn}, nil
+}
+
+type replicaConn struct {
+	rs  *replicaSet
+	dsn string
+}
+
+func (c *replicaConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare unsupported")
+}
+
+func (c *replicaConn) Close() error {
+	return nil
+}
+
+func (c *replicaConn) Begin() (driver.Tx, error) {
+	return replicaTx{}, nil
+}
+
+type replicaTx struct{}
+
+func (replicaTx) Commit() error {
+	return nil
+}
+
+func (replicaTx) Rollback() error {
+	return nil
+}
+
+func (c *replicaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.rs.isSlow(c.dsn) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	readOnly := []byte("1")
+	if c.rs.isPrimary(c.dsn) {
+		readOnly = []byte("0")
+	}
+	return &replicaRows{values: []driver.Value{readOnly, int64(0)}}, nil
+}
+
+func (c *replicaConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.HasPrefix(strings.ToUpper(query), "SET ") {
+		// session settings are allowed on read-only replicas, other than privileged settings
+		if strings.Contains(query, "sql_log_bin") && !c.rs.isPrimary(c.dsn) {
+			return nil, errors.New("Error 1227 (42000): Access denied; you need (at least one of) the SUPER privilege(s) for this operation")
+		}
+		c.rs.set(c.dsn, query)
+		return driver.ResultNoRows, nil
+	}
+	if !c.rs.isPrimary(c.dsn) {
+		return nil, errors.New("Error 1290 (HY000): The MySQL server is running with the --read-only option so it cannot execute this statement")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type replicaRows struct {
+	values []driver.Value
+}
+
+func (r *replicaRows) Columns() []string {
+	return []string{"@@read_only", "@@innodb_read_only"}
+}
+
+func (r *replicaRows) Close() error {
+	return nil
+}
+
+func (r *replicaRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.values = nil
+	return nil
+}
+
+func TestWithWriterFailover(t *testing.T) {
+	rs := &replicaSet{primary: "b"}
+	d := rwproxy.New(rs, rwproxy.WithWriterFailover(rwproxy.MySQLPrimaryDetector, nil))
+	sql.Register(t.Name(), d)
+
+	dsn := rwproxy.Cluster{
+		Writer:     rwproxy.Node{DSN: "a"},
+		Readers:    []rwproxy.Node{{DSN: "r"}},
+		Candidates: []rwproxy.Node{{DSN: "b"}, {DSN: "c"}},
+	}.StructuredDSN()
+	db, err := sql.Open(t.Name(), dsn)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	writer := func(expected string, expectedCandidates ...string) {
+		t.Helper()
+		c := d.Topology().Clusters[0]
+		if c.Writer.DSN != expected {
+			t.Errorf("expected writer %s; got %s", expected, c.Writer.DSN)
+		}
+		candidates := []string{}
+		for _, n := range c.Candidates {
+			candidates = append(candidates, n.DSN)
+		}
+		if len(candidates) != len(expectedCandidates) {
+			t.Fatalf("expected candidates %v; got %v", expectedCandidates, candidates)
+		}
+		for i := range candidates {
+			if candidates[i] != expectedCandidates[i] {
+				t.Errorf("expected candidates %v; got %v", expectedCandidates, candidates)
+			}
+		}
+	}
+
+	// the writer is found not to be the primary as it is opened
+	if _, err := db.Exec("UPDATE"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	writer("b", "a", "c")
+
+	// the writer is demoted while connected, so the write fails, but later writes go to the new primary
+	rs.setPrimary("c")
+	if _, err := db.Exec("UPDATE"); err == nil {
+		t.Fatalf("expected error writing to demoted writer")
+	}
+	writer("c", "a", "b")
+	if _, err := db.Exec("UPDATE"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stats := d.Stats(); stats.WriterConns["b"] != 0 || stats.WriterConns["c"] != 1 {
+		t.Errorf("expected the connection to b to be replaced by c; got %v", stats.WriterConns)
+	}
+
+	// no candidate is the primary
+	rs.setPrimary("")
+	if _, err := db.Exec("UPDATE"); err == nil {
+		t.Fatalf("expected error writing to demoted writer")
+	}
+	writer("c", "a", "b")
+}
+
+func TestReadOnlyError(t *testing.T) {
+	cases := []struct {
+		err      string
+		mysql    bool
+		postgres bool
+	}{
+		{err: "Error 1290: The MySQL server is running with the --read-only option so it cannot execute this statement", mysql: true},
+		{err: "Error 1836 (HY000): Running in read-only mode", mysql: true},
+		{err: "Error 1062: Duplicate entry '1' for key 'PRIMARY'"},
+		{err: "pq: cannot execute UPDATE in a read-only transaction", postgres: true},
+		{err: "pq: relation \"missing\" does not exist"},
+	}
+
+	for _, c := range cases {
+		if mysql := rwproxy.MySQLReadOnlyError(errors.New(c.err)); mysql != c.mysql {
+			t.Errorf("expected MySQLReadOnlyError %t for %s; got %t", c.mysql, c.err, mysql)
+		}
+		if postgres := rwproxy.PostgresReadOnlyError(errors.New(c.err)); postgres != c.postgres {
+			t.Errorf("expected PostgresReadOnlyError %t for %s; got %t", c.postgres, c.err, postgres)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package rwproxy
+
+import (
+	"errors"
+)
+
+// ErrReadersUnavailable is provided when every reader is drained, stale or has an open circuit, and the writer is not substituted
+var ErrReadersUnavailable = errors.New("rwproxy: no readers available")
+
+// ErrReadersStale is provided when every reader is stale, and the writer is not substituted
+var ErrReadersStale = errors.New("rwproxy: all readers are stale")
+
+// Fallback describes a reader being unavailable, for a FallbackPolicy to decide whether the writer should be substituted
+type Fallback struct {
+	// Op is the operation needing a reader: "query", "begin" (for a read-only transaction) or "ping"
+	Op string
+	// Err is the reason that no reader is available
+	Err error
+	// Stale reports whether every reader is stale, according to WithLagProbe
+	Stale bool
+}
+
+// FallbackPolicy decides whether the writer should be substituted for an unavailable reader, returning false to provide the error
+// instead
+type FallbackPolicy func(f Fallback) bool
+
+// FallbackAlways is a FallbackPolicy that always substitutes the writer, and is the default
+func FallbackAlways(f Fallback) bool {
+	return true
+}
+
+// FallbackNever is a FallbackPolicy that never substitutes the writer, e.g. for workloads that should fail rather than load the writer
+func FallbackNever(f Fallback) bool {
+	return false
+}
+
+// FallbackTransactions is a FallbackPolicy that only substitutes the writer for read-only transactions
+func FallbackTransactions(f Fallback) bool {
+	return f.Op == opBegin
+}
+
+// FallbackStale is a FallbackPolicy that only substitutes the writer when every reader is stale, according to WithLagProbe
+func FallbackStale(f Fallback) bool {
+	return f.Stale
+}
+
+// Operations needing a reader, provided as Fallback.Op
+const (
+	opQuery = "query"
+	opBegin = "begin"
+	opPing  = "ping"
+)
+
+// fallBack applies the FallbackPolicy, reporting whether the writer should be substituted for an unavailable reader
+func (rt *routing) fallBack(f Fallback) bool {
+	if !rt.driver.fallback(f) {
+		rt.step("no readers available; not substituting with writer: %s", f.Err)
+		return false
+	}
+	rt.step("no readers available; substituting with writer: %s", f.Err)
+	if !rt.explain {
+		rt.driver.stats.fellBack()
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithFallbackPolicy(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy rwproxy.FallbackPolicy
+		query  bool
+		begin  bool
+		ping   bool
+	}{
+		{name: "always", policy: rwproxy.FallbackAlways, query: true, begin: true, ping: true},
+		{name: "never", policy: rwproxy.FallbackNever},
+		{name: "transactions", policy: rwproxy.FallbackTransactions, begin: true},
+		{name: "custom", policy: func(f rwproxy.Fallback) bool { return f.Op == "ping" }, ping: true},
+	}
+
+	check := func(t *testing.T, op string, expected bool, err error) {
+		t.Helper()
+		if expected && err != nil {
+			t.Errorf("unexpected error for %s: %s", op, err)
+		} else if !expected && err == nil {
+			t.Errorf("expected error for %s", op)
+		}
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := rwproxy.New(&replicaSet{primary: "writer", down: "reader"}, rwproxy.WithFallbackPolicy(c.policy))
+
+			// each operation is the first to need a reader for its connection
+			for _, op := range []string{"query", "begin", "ping"} {
+				conn, err := d.Open("writer;reader")
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				switch op {
+				case "query":
+					_, err = conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+					check(t, op, c.query, err)
+				case "begin":
+					_, err = conn.(driver.ConnBeginTx).BeginTx(context.Background(), driver.TxOptions{ReadOnly: true})
+					check(t, op, c.begin, err)
+				case "ping":
+					err = conn.(driver.Pinger).Ping(context.Background())
+					check(t, op, c.ping, err)
+				}
+				conn.Close()
+			}
+		})
+	}
+}
+
+func TestWithFallbackPolicy_substituted(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "writer", down: "reader"}, rwproxy.WithFallbackPolicy(rwproxy.FallbackTransactions))
+	conn, err := d.Open("writer;reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.(driver.ConnBeginTx).BeginTx(context.Background(), driver.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the writer substituted for the transaction is not used for queries
+	if _, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil); err == nil {
+		t.Errorf("expected error querying substituted writer")
+	}
+}
+
+func TestWithLagProbe(t *testing.T) {
+	var mu sync.Mutex
+	lags := map[string]time.Duration{"reader-1": 5 * time.Second}
+	setLag := func(dsn string, lag time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		lags[dsn] = lag
+	}
+	probe := func(ctx context.Context, c driver.Conn) (time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return lags[c.(*replicaConn).dsn], nil
+	}
+
+	d := rwproxy.New(&replicaSet{primary: "writer"},
+		rwproxy.WithLagProbe(probe, time.Second, time.Millisecond),
+		rwproxy.WithFallbackPolicy(rwproxy.FallbackStale),
+	)
+	defer d.Close()
+
+	dsn := "writer;reader-1;reader-2"
+	conn, err := d.Open(dsn)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	awaitTargets := func(expected ...string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			ex, err := d.Explain(context.Background(), dsn, "SELECT", false, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if reflect.DeepEqual(ex.Targets, expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("targets mismatch: expected %v; got %v", expected, ex.Targets)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	awaitTargets("reader-2")
+	if readers := d.Topology().Clusters[0].Readers; !readers[0].Stale || readers[1].Stale || readers[0].Lag != 5*time.Second {
+		t.Errorf("expected only reader-1 to be stale; got %+v", readers)
+	}
+
+	// the writer is only substituted once every reader is stale
+	setLag("reader-2", 2*time.Second)
+	awaitTargets("writer")
+
+	setLag("reader-1", 0)
+	awaitTargets("reader-1")
+}
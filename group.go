@@ -0,0 +1,84 @@
+package rwproxy
+
+import (
+	"context"
+	"strings"
+)
+
+// DefaultReaderGroup is the reader group of readers without a Group, and of reads without a reader group
+const DefaultReaderGroup = "default"
+
+// groupHint is the prefix of a comment, leading a query, that provides its reader group, e.g. /* rwproxy:group=analytics */
+const groupHint = "rwproxy:group="
+
+type readerGroupKey struct{}
+
+// WithReaderGroup provides a context whose reads (including read-only transactions) are routed to the readers of the named group
+// (see Node.Group), rather than the default group
+func WithReaderGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, readerGroupKey{}, group)
+}
+
+// ReaderGroup provides the reader group of a context (see WithReaderGroup), or DefaultReaderGroup
+func ReaderGroup(ctx context.Context) string {
+	if group, ok := ctx.Value(readerGroupKey{}).(string); ok && group != "" {
+		return group
+	}
+	return DefaultReaderGroup
+}
+
+// WithReaderGroupBalancer creates an Option that picks the readers of a reader group with b, rather than the Balancer (or
+// ReaderSelector) of the Driver
+func WithReaderGroupBalancer(group string, b Balancer) Option {
+	return func(d *Driver) {
+		if d.groupBalancers == nil {
+			d.groupBalancers = map[string]Balancer{}
+		}
+		d.groupBalancers[group] = b
+		d.feedback = true
+	}
+}
+
+// WithReaderGroupSelector creates an Option that selects the readers of a reader group with rs, rather than the Balancer (or
+// ReaderSelector) of the Driver
+func WithReaderGroupSelector(group string, rs ReaderSelector) Option {
+	return func(d *Driver) {
+		if d.groupBalancers == nil {
+			d.groupBalancers = map[string]Balancer{}
+		}
+		d.groupBalancers[group] = selectorBalancer{rs}
+	}
+}
+
+// balancerFor provides the Balancer picking the readers of a reader group
+func (d *Driver) balancerFor(group string) Balancer {
+	if b, ok := d.groupBalancers[group]; ok {
+		return b
+	}
+	return d.balancer
+}
+
+// hinted provides a context with the reader group of a query's hint, if it has one, e.g. /* rwproxy:group=analytics */ SELECT ...
+func hinted(ctx context.Context, query string) context.Context {
+	query = strings.TrimSpace(query)
+	if !strings.HasPrefix(query, "/*") {
+		return ctx
+	}
+	end := strings.Index(query, "*/")
+	if end < 0 {
+		return ctx
+	}
+	comment := strings.TrimSpace(query[2:end])
+	if !strings.HasPrefix(comment, groupHint) {
+		return ctx
+	}
+	return WithReaderGroup(ctx, strings.TrimSpace(strings.TrimPrefix(comment, groupHint)))
+}
+
+// group provides the reader group of a reader
+func (n Node) group() string {
+	if n.Group == "" {
+		return DefaultReaderGroup
+	}
+	return n.Group
+}
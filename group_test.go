@@ -0,0 +1,176 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithReaderGroup(t *testing.T) {
+	cases := []struct {
+		name     string
+		group    string
+		query    string
+		tx       bool
+		policy   rwproxy.FallbackPolicy
+		err      bool
+		expected string
+	}{
+		{
+			name:     "default group",
+			query:    "SELECT",
+			expected: "oltp",
+		},
+		{
+			name:     "context",
+			group:    "analytics",
+			query:    "SELECT",
+			expected: "analytics",
+		},
+		{
+			name:     "hint",
+			query:    "/* rwproxy:group=analytics */ SELECT",
+			expected: "analytics",
+		},
+		{
+			name:     "read-only transaction",
+			group:    "analytics",
+			tx:       true,
+			expected: "analytics",
+		},
+		{
+			name:   "group without readers",
+			group:  "reporting",
+			query:  "SELECT",
+			policy: rwproxy.FallbackNever,
+			err:    true,
+		},
+	}
+
+	dsn := rwproxy.Cluster{
+		Writer: rwproxy.Node{DSN: "writer"},
+		Readers: []rwproxy.Node{
+			{DSN: "oltp"},
+			{DSN: "analytics", Group: "analytics"},
+		},
+	}.StructuredDSN()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := []rwproxy.Option{}
+			if c.policy != nil {
+				opts = append(opts, rwproxy.WithFallbackPolicy(c.policy))
+			}
+			d := rwproxy.New(&replicaSet{primary: "writer"}, opts...)
+			conn, err := d.Open(dsn)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer conn.Close()
+
+			ctx := context.Background()
+			if c.group != "" {
+				ctx = rwproxy.WithReaderGroup(ctx, c.group)
+			}
+			if c.tx {
+				_, err = conn.(driver.ConnBeginTx).BeginTx(ctx, driver.TxOptions{ReadOnly: true})
+			} else {
+				var rows driver.Rows
+				if rows, err = conn.(driver.QueryerContext).QueryContext(ctx, c.query, nil); err == nil {
+					rows.Close()
+				}
+			}
+			if c.err && err == nil {
+				t.Errorf("expected error")
+			} else if !c.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			stats := d.Stats()
+			if c.expected == "" && len(stats.ReaderConns) > 0 {
+				t.Errorf("expected no reader connections; got %v", stats.ReaderConns)
+			}
+			if c.expected != "" && (len(stats.ReaderConns) != 1 || stats.ReaderConns[c.expected] != 1) {
+				t.Errorf("expected a connection to %s; got %v", c.expected, stats.ReaderConns)
+			}
+		})
+	}
+}
+
+func TestWithReaderGroupBalancer(t *testing.T) {
+	b := &recordingBalancer{}
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithReaderGroupBalancer("analytics", b))
+	conn, err := d.Open(rwproxy.Cluster{
+		Writer: rwproxy.Node{DSN: "writer"},
+		Readers: []rwproxy.Node{
+			{DSN: "oltp"},
+			{DSN: "analytics-1", Group: "analytics"},
+			{DSN: "analytics-2", Group: "analytics"},
+		},
+	}.StructuredDSN())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// reads alternate between the groups, reusing the connection to each
+	for _, group := range []string{"default", "analytics", "default", "analytics"} {
+		ctx := rwproxy.WithReaderGroup(context.Background(), group)
+		rows, err := conn.(driver.QueryerContext).QueryContext(ctx, "SELECT", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rows.Close()
+	}
+	if stats := d.Stats(); len(stats.ReaderConns) != 2 || stats.ReaderConns["oltp"] != 1 || stats.ReaderConns["analytics-2"] != 1 {
+		t.Errorf("expected a connection to oltp and analytics-2; got %v", stats.ReaderConns)
+	}
+	conn.Close()
+
+	expected := []string{
+		"pick analytics-2",
+		"report analytics-2: <nil>",
+		"pick analytics-2",
+		"report analytics-2: <nil>",
+		"release analytics-2",
+	}
+	if len(b.feedback) != len(expected) {
+		t.Fatalf("expected %v; got %v", expected, b.feedback)
+	}
+	for i := range expected {
+		if b.feedback[i] != expected[i] {
+			t.Errorf("expected %v; got %v", expected, b.feedback)
+		}
+	}
+}
+
+func TestWithReaderGroupSelector(t *testing.T) {
+	selected := 0
+	rs := func(ctx context.Context, d driver.Driver, dsns []string) (driver.Conn, error) {
+		selected++
+		return d.Open(dsns[len(dsns)-1])
+	}
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithReaderGroupSelector("analytics", rs))
+	conn, err := d.Open(rwproxy.Cluster{
+		Writer: rwproxy.Node{DSN: "writer"},
+		Readers: []rwproxy.Node{
+			{DSN: "oltp"},
+			{DSN: "analytics-1", Group: "analytics"},
+			{DSN: "analytics-2", Group: "analytics"},
+		},
+	}.StructuredDSN())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.(driver.QueryerContext).QueryContext(rwproxy.WithReaderGroup(context.Background(), "analytics"), "SELECT", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+	if stats := d.Stats(); selected != 1 || len(stats.ReaderConns) != 1 || stats.ReaderConns["analytics-2"] != 1 {
+		t.Errorf("expected the selector to select analytics-2; got %d selections and %v", selected, stats.ReaderConns)
+	}
+}
@@ -0,0 +1,140 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// hedgeResult is the outcome of one of the queries of a hedged read
+type hedgeResult struct {
+	pc     *proxiedConn
+	rows   driver.Rows
+	err    error
+	cancel context.CancelFunc
+}
+
+// hedgedQuery queries the reader connection, issuing the same query on a second reader if the first hasn't responded within the hedge
+// delay, and providing the rows of whichever responds first
+//
+// The delegate connection of the slower query is abandoned: its query is cancelled, and it is closed once the query returns.
+func (c *conn) hedgedQuery(ctx context.Context, r *proxiedConn, query string, args []driver.NamedValue) (driver.Rows, *proxiedConn, error) {
+	results := make(chan hedgeResult, 2)
+	cancelFirst := c.startQuery(ctx, r, query, args, results)
+
+	timer := time.NewTimer(c.driver.hedgeDelay)
+	defer timer.Stop()
+	select {
+	case res := <-results:
+		return c.hedgeWon(res, nil, nil)
+	case <-timer.C:
+	}
+
+	h, err := c.hedge(ctx)
+	if err != nil {
+		c.driver.debugf("unable to hedge query: %s", err)
+		return c.hedgeWon(<-results, nil, nil)
+	}
+	c.driver.debugf("query slower than %s; hedging with: %s", c.driver.hedgeDelay, h.dsn)
+	c.driver.stats.hedged()
+	cancelHedge := c.startQuery(ctx, h, query, args, results)
+
+	res := <-results
+	if res.err != nil && res.err != driver.ErrSkip && ctx.Err() == nil {
+		// the first to respond failed, so wait for the other
+		res.cancel()
+		return c.hedgeWon(<-results, nil, nil)
+	}
+	if res.pc == h {
+		return c.hedgeWon(res, results, cancelFirst)
+	}
+	return c.hedgeWon(res, results, cancelHedge)
+}
+
+// startQuery queries a delegate connection in the background, sending the result once it responds, and providing a function to cancel
+// the query
+func (c *conn) startQuery(ctx context.Context, pc *proxiedConn, query string, args []driver.NamedValue, results chan<- hedgeResult) context.CancelFunc {
+	qctx, cancel := context.WithCancel(ctx)
+	go func() {
+		rows, err := pc.Conn.(driver.QueryerContext).QueryContext(qctx, query, args)
+		results <- hedgeResult{pc: pc, rows: rows, err: err, cancel: cancel}
+	}()
+	return cancel
+}
+
+// hedgeWon provides the rows and connection of the winning query, abandoning the losing query (if any is still pending) and its
+// connection
+func (c *conn) hedgeWon(res hedgeResult, pending <-chan hedgeResult, cancelPending context.CancelFunc) (driver.Rows, *proxiedConn, error) {
+	if pending != nil {
+		loser := c.hedgeConn
+		if res.pc == c.hedgeConn {
+			loser = c.readerConn
+			c.readerConn = c.hedgeConn
+		}
+		c.hedgeConn = nil
+		c.driver.debugf("abandoning slower hedged query on: %s", loser.dsn)
+		loser.closed = true
+		cancelPending()
+		go c.abandon(loser, pending)
+	}
+
+	if res.err != nil {
+		res.cancel()
+		return nil, res.pc, res.err
+	}
+	return newRows(res.rows, func(err error) { res.cancel() }), res.pc, nil
+}
+
+// abandon closes the connection of a cancelled query once it has returned
+func (c *conn) abandon(pc *proxiedConn, pending <-chan hedgeResult) {
+	res := <-pending
+	if res.rows != nil {
+		res.rows.Close()
+	}
+	if err := pc.Close(); err != nil {
+		c.driver.debugf("failed to close abandoned connection: %s", err)
+	}
+	c.driver.stats.connClosed(pc)
+	c.driver.released(pc)
+}
+
+// hedge provides a second reader connection, to a different reader to the reader connection
+func (c *conn) hedge(ctx context.Context) (*proxiedConn, error) {
+	rt := &routing{driver: c.driver}
+	readers, err := c.cluster.readers(rt, c.readerGroup)
+	if err != nil {
+		return nil, err
+	}
+	others := make([]string, 0, len(readers))
+	for _, dsn := range readers {
+		if dsn != c.readerConn.dsn {
+			others = append(others, dsn)
+		}
+	}
+	if len(others) == 0 {
+		return nil, ErrReadersUnavailable
+	}
+
+	if c.hedgeConn != nil {
+		for _, dsn := range others {
+			if dsn == c.hedgeConn.dsn {
+				return c.hedgeConn, nil
+			}
+		}
+		// the hedge reader is of another reader group, or no longer selectable
+		c.idle(c.hedgeConn)
+		defer c.closeIdleReaders(c.hedgeConn)
+		c.hedgeConn = nil
+	}
+
+	pc, err := c.selectReader(ctx, rt, others)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := pc.Conn.(driver.QueryerContext); !ok {
+		c.closeConn(pc)
+		return nil, driver.ErrSkip
+	}
+	c.hedgeConn = pc
+	return c.hedgeConn, nil
+}
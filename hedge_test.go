@@ -0,0 +1,60 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithHedgedReads(t *testing.T) {
+	rs := &replicaSet{primary: "writer", slow: "reader-1"}
+	d := rwproxy.New(rs, rwproxy.WithReaderSelector(rwproxy.RoundRobinReaderSelector()), rwproxy.WithHedgedReads(time.Millisecond))
+	conn, err := d.Open("writer;reader-1;reader-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	query := func() {
+		t.Helper()
+		rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := rows.Close(); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+
+	// the slow reader is hedged with the other, and its connection closed once its query is cancelled
+	query()
+	deadline := time.Now().Add(time.Second)
+	for d.Stats().ReaderConns["reader-1"] != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stats := d.Stats()
+	if stats.ReaderConns["reader-1"] != 0 || stats.ReaderConns["reader-2"] != 1 {
+		t.Errorf("expected the connection to reader-1 to be replaced by reader-2; got %v", stats.ReaderConns)
+	}
+	if stats.Hedges != 1 {
+		t.Errorf("expected 1 hedge; got %d", stats.Hedges)
+	}
+
+	// the winning reader continues to be used while it responds in time
+	query()
+	if stats := d.Stats(); stats.Hedges != 1 {
+		t.Errorf("expected 1 hedge; got %d", stats.Hedges)
+	}
+
+	// with no other reader to hedge with, the slow query is waited for
+	rs.setSlow("reader-2")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rs.setDown("reader-1")
+	if _, err := conn.(driver.QueryerContext).QueryContext(ctx, "SELECT", nil); err != context.DeadlineExceeded {
+		t.Errorf("expected %s; got %v", context.DeadlineExceeded, err)
+	}
+}
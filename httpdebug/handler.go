@@ -0,0 +1,74 @@
+// Package httpdebug provides an http.Handler describing the topology and routing of an rwproxy Driver
+//
+// The handler is intended for operational inspection of a live service, and should not be exposed publicly:
+//
+//	http.Handle("/debug/rwproxy", httpdebug.Handler(d))
+//
+// DSNs are redacted with rwproxy.RedactDSN. JSON is rendered for requests with ?format=json, or that accept application/json,
+// and HTML otherwise.
+package httpdebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/nedscode/rwproxy"
+)
+
+// Handler creates an http.Handler rendering the current rwproxy.Topology of d
+func Handler(d *rwproxy.Driver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := redact(d.Topology())
+
+		if wantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(t); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := page.Execute(w, t); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func wantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// redact obscures every DSN in the topology
+func redact(t rwproxy.Topology) rwproxy.Topology {
+	for i, c := range t.Clusters {
+		c.Writer.DSN = rwproxy.RedactDSN(c.Writer.DSN)
+		for j := range c.Readers {
+			c.Readers[j].DSN = rwproxy.RedactDSN(c.Readers[j].DSN)
+		}
+		for j := range c.Candidates {
+			c.Candidates[j].DSN = rwproxy.RedactDSN(c.Candidates[j].DSN)
+		}
+		t.Clusters[i] = c
+	}
+	t.Stats.WriterConns = redactKeys(t.Stats.WriterConns)
+	t.Stats.ReaderConns = redactKeys(t.Stats.ReaderConns)
+	for i := range t.Decisions {
+		t.Decisions[i].DSN = rwproxy.RedactDSN(t.Decisions[i].DSN)
+	}
+	return t
+}
+
+func redactKeys(counts map[string]int) map[string]int {
+	r := make(map[string]int, len(counts))
+	for dsn, n := range counts {
+		r[rwproxy.RedactDSN(dsn)] += n
+	}
+	return r
+}
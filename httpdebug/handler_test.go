@@ -0,0 +1,74 @@
+package httpdebug_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+	"github.com/nedscode/rwproxy/httpdebug"
+	"github.com/nedscode/rwproxy/sqldrivermock"
+)
+
+func TestHandler(t *testing.T) {
+	mockDrv := sqldrivermock.New()
+	d := rwproxy.New(mockDrv, rwproxy.WithCircuitBreaker(rwproxy.CircuitBreaker{}))
+	defer d.Close()
+	sql.Register(t.Name(), d)
+
+	expect := mockDrv.Expect()
+	expect.Open().WithDSN("user:secret@writer")
+	expect.Open().WithDSN("user:secret@reader")
+
+	db, err := sql.Open(t.Name(), "user:secret@writer;user:secret@reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	h := httpdebug.Handler(d)
+
+	// JSON
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=json", nil))
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("expected DSNs to be redacted, got: %s", rec.Body.String())
+	}
+	var topo rwproxy.Topology
+	if err := json.Unmarshal(rec.Body.Bytes(), &topo); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(topo.Clusters) != 1 || len(topo.Clusters[0].Readers) != 1 {
+		t.Fatalf("expected 1 cluster with 1 reader, got %+v", topo.Clusters)
+	}
+	if dsn := topo.Clusters[0].Writer.DSN; dsn != "user:xxxxx@writer" {
+		t.Errorf("writer DSN mismatch: expected %#v; got %#v", "user:xxxxx@writer", dsn)
+	}
+
+	// HTML
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expected HTML, got %s", ct)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret") || !strings.Contains(body, "user:xxxxx@reader") {
+		t.Errorf("expected redacted reader DSN, got: %s", body)
+	}
+
+	// every row of the clusters table has a cell per column
+	body := rec.Body.String()
+	clusters := body[strings.Index(body, "<h2>Clusters</h2>"):strings.Index(body, "<h2>Delegate connections</h2>")]
+	rows := strings.Split(clusters, "</tr>")
+	columns := strings.Count(rows[0], "<th>")
+	for _, row := range rows[1 : len(rows)-1] {
+		if cells := strings.Count(row, "<td"); cells != columns {
+			t.Errorf("expected %d cells; got %d: %s", columns, cells, row)
+		}
+	}
+}
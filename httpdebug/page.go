@@ -0,0 +1,68 @@
+package httpdebug
+
+import (
+	"html/template"
+)
+
+var page = template.Must(template.New("topology").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rwproxy</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.unhealthy { color: #c00; }
+</style>
+</head>
+<body>
+<h1>rwproxy</h1>
+<p>Selector: <code>{{.Selector}}</code> &middot; <a href="?format=json">JSON</a></p>
+
+<h2>Clusters</h2>
+{{range $i, $c := .Clusters}}
+{{if $c.Degraded}}<p class="unhealthy">Degraded: the writer is unavailable, and only reads are being served.</p>{{end}}
+<table>
+<tr><th>Role</th><th>Name</th><th>DSN</th><th>Group</th><th>Zone</th><th>Weight</th><th>Health</th><th>Lag</th><th>Circuit</th></tr>
+<tr><td>writer</td>{{template "node" $c.Writer}}</tr>
+{{range $c.Readers}}<tr><td>reader</td>{{template "node" .}}</tr>
+{{end}}{{range $c.Candidates}}<tr><td>writer candidate</td>{{template "node" .}}</tr>
+{{end}}
+</table>
+{{else}}
+<p>No clusters have been opened.</p>
+{{end}}
+
+<h2>Delegate connections</h2>
+<table>
+<tr><th>Role</th><th>DSN</th><th>Open</th></tr>
+{{range $dsn, $n := .Stats.WriterConns}}<tr><td>writer</td><td><code>{{$dsn}}</code></td><td>{{$n}}</td></tr>
+{{end}}{{range $dsn, $n := .Stats.ReaderConns}}<tr><td>reader</td><td><code>{{$dsn}}</code></td><td>{{$n}}</td></tr>
+{{end}}
+</table>
+<table>
+<tr><th>Writer transactions</th><td>{{.Stats.WriterTxs}}</td></tr>
+<tr><th>Reader transactions</th><td>{{.Stats.ReaderTxs}}</td></tr>
+<tr><th>Prepared statements</th><td>{{.Stats.Stmts}}</td></tr>
+<tr><th>Writer routes</th><td>{{.Stats.WriterRoutes}}</td></tr>
+<tr><th>Reader routes</th><td>{{.Stats.ReaderRoutes}}</td></tr>
+<tr><th>Fallbacks</th><td>{{.Stats.Fallbacks}}</td></tr>
+<tr><th>Hedged queries</th><td>{{.Stats.Hedges}}</td></tr>
+<tr><th>Pinned writer connections</th><td>{{.Stats.PinnedConns}}</td></tr>
+<tr><th>Pins</th><td>{{.Stats.Pins}}</td></tr>
+</table>
+
+<h2>Recent routing decisions</h2>
+<table>
+<tr><th>Time</th><th>Op</th><th>Role</th><th>DSN</th></tr>
+{{range .Decisions}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Op}}</td><td>{{.Role}}</td><td><code>{{.DSN}}</code></td></tr>
+{{end}}
+</table>
+</body>
+</html>
+{{define "node"}}<td>{{.Name}}</td><td><code>{{.DSN}}</code></td><td>{{.Group}}</td><td>{{.Zone}}</td><td>{{if .Weight}}{{.Weight}}{{end}}</td>
+{{- if .Drained}}<td>drained</td>{{else if .Healthy}}<td>healthy</td>{{else}}<td class="unhealthy">unhealthy: {{.LastError}}</td>{{end}}
+{{- if .Stale}}<td class="unhealthy">stale</td>{{else if .Lag}}<td>{{.Lag}}</td>{{else}}<td></td>{{end}}
+{{- if .Circuit}}<td{{if ne .Circuit "closed"}} class="unhealthy"{{end}}>{{.Circuit}}</td>{{else}}<td></td>{{end}}{{end}}
+`))
@@ -0,0 +1,168 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LagProbe measures the replication lag of a reader, through a delegate connection to it
+type LagProbe func(ctx context.Context, c driver.Conn) (time.Duration, error)
+
+// MySQLLagProbe measures the replication lag of a MySQL replica as reported by Seconds_Behind_Source (or Seconds_Behind_Master), failing
+// if replication is not running
+func MySQLLagProbe(ctx context.Context, c driver.Conn) (time.Duration, error) {
+	columns, values, err := queryRow(ctx, c, "SHOW REPLICA STATUS")
+	if err != nil {
+		// prior to MySQL 8.0.22
+		if columns, values, err = queryRow(ctx, c, "SHOW SLAVE STATUS"); err != nil {
+			return 0, err
+		}
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, errors.New("rwproxy: replication is not running")
+		}
+		seconds, err := parseSeconds(values[i])
+		if err != nil {
+			return 0, err
+		}
+		return seconds, nil
+	}
+	return 0, errors.New("rwproxy: replication lag is not reported")
+}
+
+// PostgresLagProbe measures the replication lag of a PostgreSQL standby as the age of the last replayed transaction
+//
+// As this includes any time during which the primary has been idle, maxLag should allow for the write rate of the primary.
+func PostgresLagProbe(ctx context.Context, c driver.Conn) (time.Duration, error) {
+	_, values, err := queryRow(ctx, c, "SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)")
+	if err != nil {
+		return 0, err
+	}
+	return parseSeconds(values[0])
+}
+
+// lagProbes periodically measures the replication lag of every reader
+type lagProbes struct {
+	probe    LagProbe
+	maxLag   time.Duration
+	interval time.Duration
+
+	// conns are the delegate connections used to probe each reader, by DSN, only used by the probing goroutine
+	conns map[string]driver.Conn
+
+	mu   sync.Mutex
+	lags map[string]time.Duration
+}
+
+// lag provides the most recently measured lag of a reader, if any
+func (lp *lagProbes) lag(dsn string) (time.Duration, bool) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	l, ok := lp.lags[dsn]
+	return l, ok
+}
+
+// watchLag periodically probes the lag of every reader until the Driver is closed
+func (d *Driver) watchLag() {
+	d.every(d.lagProbes.interval, d.probeLag)
+
+	for dsn, c := range d.lagProbes.conns {
+		c.Close()
+		delete(d.lagProbes.conns, dsn)
+	}
+}
+
+// probeLag measures the lag of every reader, marking those that exceed the maximum lag (or can't be measured) as stale
+func (d *Driver) probeLag() {
+	lp := d.lagProbes
+	probed := map[string]bool{}
+	for _, cl := range d.openedClusters() {
+		for _, n := range cl.spec().Readers {
+			probed[n.DSN] = true
+			l, err := d.measureLag(n.DSN)
+
+			lp.mu.Lock()
+			if err != nil {
+				delete(lp.lags, n.DSN)
+			} else {
+				lp.lags[n.DSN] = l
+			}
+			lp.mu.Unlock()
+
+			stale := err != nil || l > lp.maxLag
+			if !cl.setStale(n.DSN, stale) {
+				continue
+			}
+			switch {
+			case err != nil:
+				d.debugf("reader stale; lag could not be measured: %s: %s", n, err)
+			case stale:
+				d.debugf("reader stale; lag of %s exceeds %s: %s", l, lp.maxLag, n)
+			default:
+				d.debugf("reader caught up; lag of %s: %s", l, n)
+			}
+		}
+	}
+
+	// close connections to removed readers
+	for dsn, c := range lp.conns {
+		if !probed[dsn] {
+			c.Close()
+			delete(lp.conns, dsn)
+		}
+	}
+}
+
+func (d *Driver) measureLag(dsn string) (time.Duration, error) {
+	lp := d.lagProbes
+	ctx, cancel := context.WithTimeout(context.Background(), lp.interval)
+	defer cancel()
+
+	c := lp.conns[dsn]
+	if c == nil {
+		if err := d.allow(dsn); err != nil {
+			return 0, err
+		}
+		var err error
+		if c, err = d.proxiedDriver.Open(dsn); err != nil {
+			return 0, err
+		}
+		lp.conns[dsn] = c
+	}
+
+	l, err := lp.probe(ctx, c)
+	if err != nil {
+		c.Close()
+		delete(lp.conns, dsn)
+	}
+	return l, err
+}
+
+// parseSeconds interprets a number of seconds returned by a delegate driver as an integer, float or string
+func parseSeconds(v driver.Value) (time.Duration, error) {
+	var seconds float64
+	switch v := v.(type) {
+	case int64:
+		seconds = float64(v)
+	case float64:
+		seconds = v
+	case []byte, string:
+		var err error
+		if seconds, err = strconv.ParseFloat(fmt.Sprintf("%s", v), 64); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("rwproxy: unexpected number of seconds %#v", v)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,141 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+// statusConn is a fake delegate connection returning a single row (or none) for each query beginning with one of its keys, and failing
+// any other query
+type statusConn map[string]statusRows
+
+func (c statusConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare unsupported")
+}
+
+func (c statusConn) Close() error {
+	return nil
+}
+
+func (c statusConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("begin unsupported")
+}
+
+func (c statusConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	for prefix, rows := range c {
+		if strings.HasPrefix(query, prefix) {
+			return &rows, nil
+		}
+	}
+	return nil, errors.New("Error 1064 (42000): You have an error in your SQL syntax")
+}
+
+type statusRows struct {
+	columns []string
+	values  []driver.Value
+}
+
+func (r *statusRows) Columns() []string {
+	return r.columns
+}
+
+func (r *statusRows) Close() error {
+	return nil
+}
+
+func (r *statusRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.values = nil
+	return nil
+}
+
+func TestLagProbes(t *testing.T) {
+	replica := func(column string, seconds driver.Value) statusRows {
+		return statusRows{columns: []string{"Replica_IO_State", column}, values: []driver.Value{[]byte("Waiting for source"), seconds}}
+	}
+	epoch := func(seconds driver.Value) statusConn {
+		return statusConn{"SELECT": {columns: []string{"coalesce"}, values: []driver.Value{seconds}}}
+	}
+
+	cases := []struct {
+		name  string
+		probe rwproxy.LagProbe
+		conn  statusConn
+		lag   time.Duration
+		err   bool
+	}{
+		{name: "mysql", probe: rwproxy.MySQLLagProbe, conn: statusConn{"SHOW REPLICA STATUS": replica("Seconds_Behind_Source", int64(3))}, lag: 3 * time.Second},
+		{name: "mysql before 8.0.22", probe: rwproxy.MySQLLagProbe, conn: statusConn{"SHOW SLAVE STATUS": replica("Seconds_Behind_Master", []byte("12"))}, lag: 12 * time.Second},
+		{name: "mysql replication stopped", probe: rwproxy.MySQLLagProbe, conn: statusConn{"SHOW REPLICA STATUS": replica("Seconds_Behind_Source", nil)}, err: true},
+		{name: "mysql not a replica", probe: rwproxy.MySQLLagProbe, conn: statusConn{"SHOW REPLICA STATUS": {columns: []string{"Seconds_Behind_Source"}}}, err: true},
+		{name: "mysql lag not reported", probe: rwproxy.MySQLLagProbe, conn: statusConn{"SHOW REPLICA STATUS": replica("Last_Error", []byte(""))}, err: true},
+		{name: "mysql invalid seconds", probe: rwproxy.MySQLLagProbe, conn: statusConn{"SHOW REPLICA STATUS": replica("Seconds_Behind_Source", []byte("soon"))}, err: true},
+		{name: "postgres integer", probe: rwproxy.PostgresLagProbe, conn: epoch(int64(2)), lag: 2 * time.Second},
+		{name: "postgres float", probe: rwproxy.PostgresLagProbe, conn: epoch(1.5), lag: 1500 * time.Millisecond},
+		{name: "postgres bytes", probe: rwproxy.PostgresLagProbe, conn: epoch([]byte("0.25")), lag: 250 * time.Millisecond},
+		{name: "postgres string", probe: rwproxy.PostgresLagProbe, conn: epoch("4"), lag: 4 * time.Second},
+		{name: "postgres not a standby", probe: rwproxy.PostgresLagProbe, conn: epoch(float64(0))},
+		{name: "postgres null", probe: rwproxy.PostgresLagProbe, conn: epoch(nil), err: true},
+		{name: "postgres invalid seconds", probe: rwproxy.PostgresLagProbe, conn: epoch([]byte("soon")), err: true},
+		{name: "postgres unexpected type", probe: rwproxy.PostgresLagProbe, conn: epoch(true), err: true},
+		{name: "postgres query fails", probe: rwproxy.PostgresLagProbe, conn: statusConn{}, err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lag, err := c.probe(context.Background(), c.conn)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error; got lag of %s", lag)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if lag != c.lag {
+				t.Errorf("expected lag of %s; got %s", c.lag, lag)
+			}
+		})
+	}
+}
+
+func TestWithLagProbe_defaultInterval(t *testing.T) {
+	probed := make(chan struct{}, 1)
+	probe := func(ctx context.Context, c driver.Conn) (time.Duration, error) {
+		select {
+		case probed <- struct{}{}:
+		default:
+		}
+		return 0, nil
+	}
+
+	// a non-positive interval is replaced by the default, rather than panicking in the background
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithLagProbe(probe, time.Second, 0))
+	defer d.Close()
+
+	conn, err := d.Open("writer;reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	select {
+	case <-probed:
+		t.Errorf("expected readers not to be probed before the default interval")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,121 @@
+package rwproxy
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LatencyReaderSelector is a Balancer picking readers by an exponentially weighted moving average of their query latency and error
+// rate, as reported by rwproxy's own query paths (see WithLatencyReaderSelector)
+//
+// Two distinct readers are chosen at random, and the one with the lower score (average latency, plus the error rate weighted by
+// ErrorPenalty) is selected, so that the fastest readers are preferred without every connection herding onto the single fastest. Readers
+// yet to be observed score zero, so are tried first. A score decays with the time since it was last observed, so that readers penalised
+// in the past are eventually tried again.
+type LatencyReaderSelector struct {
+	// HalfLife is the time over which the weight of an observation halves (default 10 seconds)
+	HalfLife time.Duration
+	// ErrorPenalty is the latency that an error rate of 1 is considered equivalent to (default 1 second)
+	ErrorPenalty time.Duration
+	// Now provides the current time (default time.Now), e.g. for testing
+	Now func() time.Time
+	// Intn provides a random int in [0,n) (default rand.Intn), e.g. for testing
+	Intn func(n int) int
+
+	mu      sync.Mutex
+	readers map[string]*readerLatency
+}
+
+// readerLatency is the moving average latency and error rate of a reader, as of its last observation
+type readerLatency struct {
+	latency float64
+	errors  float64
+	at      time.Time
+}
+
+// Pick implements Balancer, picking the better scoring of two random readers
+func (s *LatencyReaderSelector) Pick(ctx context.Context, dsns []string) (string, error) {
+	dsn := dsns[0]
+	if len(dsns) > 1 {
+		intn := s.Intn
+		if intn == nil {
+			intn = rand.Intn
+		}
+		i, j := intn(len(dsns)), intn(len(dsns)-1)
+		if j >= i {
+			j++
+		}
+		dsn = dsns[i]
+		if s.Score(dsns[j]) < s.Score(dsn) {
+			dsn = dsns[j]
+		}
+	}
+	return dsn, nil
+}
+
+// Report implements Balancer, recording the latency of a query against a reader, or its failure
+func (s *LatencyReaderSelector) Report(dsn string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	now := s.now()
+	r := s.readers[dsn]
+	if r == nil {
+		if s.readers == nil {
+			s.readers = map[string]*readerLatency{}
+		}
+		s.readers[dsn] = &readerLatency{latency: float64(latency), errors: failed, at: now}
+		return
+	}
+
+	w := s.decay(now.Sub(r.at))
+	if err == nil {
+		// failures are typically fast, so only successes contribute to the latency
+		r.latency = r.latency*w + float64(latency)*(1-w)
+	}
+	r.errors = r.errors*w + failed*(1-w)
+	r.at = now
+}
+
+// Release implements Balancer, ignoring the release
+func (s *LatencyReaderSelector) Release(dsn string) {}
+
+// Score provides the current score of a reader, where lower is better
+func (s *LatencyReaderSelector) Score(dsn string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.readers[dsn]
+	if r == nil {
+		return 0
+	}
+	penalty := s.ErrorPenalty
+	if penalty <= 0 {
+		penalty = time.Second
+	}
+	score := (r.latency + r.errors*float64(penalty)) * s.decay(s.now().Sub(r.at))
+	return time.Duration(score)
+}
+
+// decay provides the weight of an observation made elapsed ago
+func (s *LatencyReaderSelector) decay(elapsed time.Duration) float64 {
+	halfLife := s.HalfLife
+	if halfLife <= 0 {
+		halfLife = 10 * time.Second
+	}
+	return math.Exp2(-float64(elapsed) / float64(halfLife))
+}
+
+func (s *LatencyReaderSelector) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
@@ -0,0 +1,114 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestLatencyReaderSelector(t *testing.T) {
+	type observation struct {
+		after   time.Duration
+		dsn     string
+		latency time.Duration
+		err     error
+	}
+	cases := []struct {
+		name         string
+		observations []observation
+		expected     string
+	}{
+		{
+			name:     "unobserved",
+			expected: "a",
+		},
+		{
+			name: "faster",
+			observations: []observation{
+				{dsn: "a", latency: 20 * time.Millisecond},
+				{dsn: "b", latency: 10 * time.Millisecond},
+			},
+			expected: "b",
+		},
+		{
+			name: "unobserved preferred",
+			observations: []observation{
+				{dsn: "a", latency: time.Millisecond},
+			},
+			expected: "b",
+		},
+		{
+			name: "failing",
+			observations: []observation{
+				{dsn: "a", latency: time.Millisecond, err: errors.New("failed")},
+				{dsn: "b", latency: 10 * time.Millisecond},
+			},
+			expected: "b",
+		},
+		{
+			name: "moving average",
+			observations: []observation{
+				{dsn: "a", latency: 10 * time.Millisecond},
+				{dsn: "b", latency: 25 * time.Millisecond},
+				{after: time.Second, dsn: "a", latency: 50 * time.Millisecond},
+			},
+			expected: "b",
+		},
+		{
+			name: "decayed",
+			observations: []observation{
+				{dsn: "a", latency: 100 * time.Millisecond},
+				{after: 10 * time.Second, dsn: "b", latency: 10 * time.Millisecond},
+			},
+			expected: "a",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			s := &rwproxy.LatencyReaderSelector{
+				HalfLife: time.Second,
+				Now:      func() time.Time { return now },
+				Intn:     func(n int) int { return 0 },
+			}
+			for _, o := range c.observations {
+				now = now.Add(o.after)
+				s.Report(o.dsn, o.latency, o.err)
+			}
+
+			dsn, err := s.Pick(context.Background(), []string{"a", "b"})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if dsn != c.expected {
+				t.Errorf("expected %s; got %s", c.expected, dsn)
+			}
+		})
+	}
+}
+
+func TestWithLatencyReaderSelector(t *testing.T) {
+	s := &rwproxy.LatencyReaderSelector{Intn: func(n int) int { return 0 }}
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithLatencyReaderSelector(s))
+	conn, err := d.Open("writer;reader-1;reader-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if s.Score("reader-1") == 0 {
+		t.Errorf("expected the query latency of reader-1 to be observed")
+	}
+}
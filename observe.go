@@ -0,0 +1,106 @@
+package rwproxy
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	pathConn = "conn"
+	pathStmt = "stmt"
+)
+
+// observer is notified of every observed statement, once it has completed
+type observer func(o *observation)
+
+// observation records the execution of a single statement against a delegate connection
+type observation struct {
+	driver *Driver
+
+	query string
+	role  string
+	dsn   string
+	group string
+	path  string
+	exec  bool
+	args  []driver.NamedValue
+
+	start        time.Time
+	duration     time.Duration
+	rowsDuration time.Duration
+	res          driver.Result
+	err          error
+}
+
+// observe starts observing a statement about to be executed, returning nil if there are no observers
+func (d *Driver) observe(pc *proxiedConn, path, query string, exec bool) *observation {
+	if len(d.observers) == 0 {
+		return nil
+	}
+	return &observation{driver: d, query: query, role: pc.role, dsn: pc.dsn, group: pc.group, path: path, exec: exec, start: time.Now()}
+}
+
+// withValues records the arguments of the statement
+func (o *observation) withValues(args []driver.Value) *observation {
+	if o == nil {
+		return nil
+	}
+	o.args = valuesToNamedValues(args)
+	return o
+}
+
+// withNamedValues records the arguments of the statement
+func (o *observation) withNamedValues(args []driver.NamedValue) *observation {
+	if o == nil {
+		return nil
+	}
+	o.args = args
+	return o
+}
+
+// on records the connection the statement was executed on, where it was not known when the observation started
+func (o *observation) on(pc *proxiedConn) *observation {
+	if o == nil {
+		return nil
+	}
+	o.role, o.dsn, o.group = pc.role, pc.dsn, pc.group
+	return o
+}
+
+// result completes the observation of an exec
+func (o *observation) result(res driver.Result, err error) (driver.Result, error) {
+	if o == nil || err == driver.ErrSkip {
+		return res, err
+	}
+	o.duration = time.Since(o.start)
+	o.res = res
+	o.err = err
+	o.done()
+	return res, err
+}
+
+// rows completes the observation of a query once the returned rows have been closed
+func (o *observation) rows(r driver.Rows, err error) (driver.Rows, error) {
+	if o == nil || err == driver.ErrSkip {
+		return r, err
+	}
+	o.duration = time.Since(o.start)
+	if err != nil {
+		o.err = err
+		o.done()
+		return r, err
+	}
+
+	streaming := time.Now()
+	return newRows(r, func(err error) {
+		o.rowsDuration = time.Since(streaming)
+		o.err = err
+		o.done()
+	}), nil
+}
+
+func (o *observation) done() {
+	for _, obs := range o.driver.observers {
+		obs(o)
+	}
+}
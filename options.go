@@ -3,6 +3,10 @@ package rwproxy
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Option is a configuration option for a Driver instance
@@ -11,20 +15,99 @@ type Option func(*Driver)
 // WithReaderSelector creates an Option for the given ReaderSelector implementation
 func WithReaderSelector(rs ReaderSelector) Option {
 	return func(d *Driver) {
-		d.selector = rs
+		d.balancer = selectorBalancer{rs}
 	}
 }
 
 // RoundRobinReaderSelector implements a round robin strategy for selecting a reader by DSN
 func RoundRobinReaderSelector() ReaderSelector {
+	var mu sync.Mutex
 	next := 0
 	return func(ctx context.Context, d driver.Driver, dsns []string) (driver.Conn, error) {
+		mu.Lock()
+		// the readers may have changed since the last selection
+		next %= len(dsns)
 		dsn := dsns[next]
 		next = (next + 1) % len(dsns)
+		mu.Unlock()
 		return d.Open(dsn)
 	}
 }
 
+// LeastConnectionsReaderSelector implements a strategy selecting the reader with the fewest delegate connections open from this
+// process, breaking ties round robin, e.g. to keep the connections to each reader balanced once a reader is restarted
+func LeastConnectionsReaderSelector() ReaderSelector {
+	var mu sync.Mutex
+	next := 0
+	return func(ctx context.Context, d driver.Driver, dsns []string) (driver.Conn, error) {
+		cc, ok := d.(ConnCounter)
+		if !ok {
+			return nil, errors.New("rwproxy: open connections are not counted by the driver")
+		}
+		mu.Lock()
+		first := next % len(dsns)
+		next = (first + 1) % len(dsns)
+		mu.Unlock()
+
+		dsn, fewest := "", 0
+		for i := range dsns {
+			candidate := dsns[(first+i)%len(dsns)]
+			if n := cc.OpenConns(candidate); dsn == "" || n < fewest {
+				dsn, fewest = candidate, n
+			}
+		}
+		return d.Open(dsn)
+	}
+}
+
+// WithLatencyReaderSelector creates an Option that selects readers with s, reporting the latency and errors of every query against a
+// reader to it
+func WithLatencyReaderSelector(s *LatencyReaderSelector) Option {
+	return WithBalancer(s)
+}
+
+// WithDSNValidator creates an Option for the given DSNValidator, used to validate each delegate DSN when a compound DSN is opened
+//
+// Compound DSNs are then also validated as by ParseCompoundDSNStrict, rejecting empty, duplicated and writer DSNs as readers.
+func WithDSNValidator(v DSNValidator) Option {
+	return func(d *Driver) {
+		d.validator = v
+	}
+}
+
+// WithConfigFile creates an Option that loads the writer and readers from a configuration file, rather than the compound DSN
+//
+// The DSN provided to sql.Open() is ignored. The file is checked for changes at each interval (unless interval is 0), and any changes to
+// its writer and readers are applied atomically: new connections and reader selections use the new nodes, and connections to removed
+// nodes are closed when next used. Driver.Close stops watching the file.
+//
+// The file's format is chosen by its extension; see ConfigDecoder.
+func WithConfigFile(path string, interval time.Duration) Option {
+	return func(d *Driver) {
+		d.config = &configFile{path: path, interval: interval}
+	}
+}
+
+// WithConfigDecoder creates an Option that decodes configuration files with the given extension (e.g. ".yaml") using dec
+func WithConfigDecoder(ext string, dec ConfigDecoder) Option {
+	return func(d *Driver) {
+		d.configDecoders[strings.ToLower(ext)] = dec
+	}
+}
+
+// WithReaderSource creates an Option that replaces the readers of each cluster with those provided by src, refreshed at each interval
+// (unless interval is 0) until Driver.Close is called
+//
+// It can't be used with WithShards, as each shard has its own readers: opening a connection provides ErrShardedReaderSource.
+//
+// Connections to readers no longer provided by src are closed when next used. If src fails, or takes longer than the interval (or 5
+// seconds) to respond, the current readers are retained.
+func WithReaderSource(src ReaderSource, interval time.Duration) Option {
+	return func(d *Driver) {
+		d.readerSource = &readerSource{ReaderSource: src, interval: interval}
+	}
+}
+
 // WithLog creates an Option for the given Log implementation
 //
 // The log will be called with near-trace-level debugging to inspect proxying behaviour
@@ -33,3 +116,140 @@ func WithLog(l Log) Option {
 		d.logFunc = l
 	}
 }
+
+// WithSlowQueryLog creates an Option that calls the given SlowQueryLog with each statement taking at least threshold
+//
+// The time taken includes streaming any rows, until the rows are closed.
+func WithSlowQueryLog(threshold time.Duration, l SlowQueryLog) Option {
+	return func(d *Driver) {
+		d.observers = append(d.observers, slowQueryObserver(threshold, l))
+	}
+}
+
+// WithAuditor creates an Option that calls the given Auditor with a record of every statement routed to a writer
+//
+// NewJSONLinesAuditor provides a file-based Auditor:
+//
+//	a, _ := rwproxy.NewJSONLinesAuditor("/var/log/app/audit.jsonl", 100<<20)
+//	rwproxy.New(delegate, rwproxy.WithAuditor(a.Audit))
+func WithAuditor(a Auditor) Option {
+	return func(d *Driver) {
+		d.observers = append(d.observers, auditObserver(a))
+	}
+}
+
+// WithDegradedMode creates an Option that keeps reads flowing while a cluster's writer is unavailable
+//
+// When the writer can't be opened (nor, with WithWriterFailover, any writer candidate), the cluster enters degraded mode: writes and
+// read-write transactions fail fast with ErrWriterUnavailable, without attempting to open the writer, while queries and read-only
+// transactions continue on the readers, and Ping reports the connection healthy if its reader is. The writer is probed at each
+// probeInterval (or every 5 seconds, if 0) and normal mode is restored once it can be opened.
+func WithDegradedMode(probeInterval time.Duration) Option {
+	if probeInterval <= 0 {
+		probeInterval = defaultProbeInterval
+	}
+	return func(d *Driver) {
+		d.degradedProbe = probeInterval
+	}
+}
+
+// ReaderRetry configures how a reader is selected for a connection by WithReaderRetry
+type ReaderRetry struct {
+	// Attempts is the number of distinct readers tried before giving up (default 1)
+	Attempts int
+	// Backoff is the delay before the second attempt, doubling before each further attempt
+	Backoff time.Duration
+}
+
+// WithReaderRetry creates an Option that retries reader selection with other readers when the selected reader fails to open
+//
+// Readers that have failed are excluded from later attempts for the same connection, and the backoff between attempts is abandoned if
+// the context is done.
+func WithReaderRetry(r ReaderRetry) Option {
+	return func(d *Driver) {
+		d.retry = r
+	}
+}
+
+// WithFallbackPolicy creates an Option that decides whether the writer is substituted when no reader is available for a query, a
+// read-only transaction or Ping, e.g. FallbackNever to fail rather than load the writer
+//
+// The writer is always used if the cluster has no readers at all.
+func WithFallbackPolicy(p FallbackPolicy) Option {
+	return func(d *Driver) {
+		d.fallback = p
+	}
+}
+
+// WithLagProbe creates an Option that measures the replication lag of each reader with probe at each interval (or every 5 seconds, if
+// 0), each measurement timing out after the interval
+//
+// Readers lagging by more than maxLag, or whose lag can't be measured, are stale: they are not selected until they catch up, and the
+// writer is substituted (subject to the FallbackPolicy, see FallbackStale) if every reader is stale.
+func WithLagProbe(probe LagProbe, maxLag, interval time.Duration) Option {
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	return func(d *Driver) {
+		d.lagProbes = &lagProbes{
+			probe:    probe,
+			maxLag:   maxLag,
+			interval: interval,
+			conns:    map[string]driver.Conn{},
+			lags:     map[string]time.Duration{},
+		}
+	}
+}
+
+// WithHedgedReads creates an Option that protects queries from slow readers: if a query (made with QueryContext, outside of a
+// transaction) hasn't responded within delay, the same query is issued on a second reader, and whichever responds first is used
+//
+// The slower query is cancelled, and its delegate connection closed once it returns, so each hedged query may cost a new delegate
+// connection. Queries must be safe to repeat, as both may have been executed.
+func WithHedgedReads(delay time.Duration) Option {
+	return func(d *Driver) {
+		d.hedgeDelay = delay
+	}
+}
+
+// WithShards creates an Option that routes each statement and transaction to one of several clusters (shards), by the compound DSN of
+// each shard's name, with the shard resolved from its context by resolve (or ShardKeyResolver, when nil)
+//
+// The DSN provided to sql.Open() is ignored. Each shard retains its own writer and reader connections, and reads are split from writes
+// within the shard. Statements whose shard can't be resolved fail, except Ping, which pings every shard. Driver.AddReader and SetWriter
+// change the shard they are given the name of.
+func WithShards(shards map[string]string, resolve ShardResolver) Option {
+	return func(d *Driver) {
+		d.shards = newShards(shards, resolve)
+	}
+}
+
+// WithCircuitBreaker creates an Option that tracks failures to connect to each node with a circuit breaker
+//
+// A node's circuit opens after consecutive failures to open a connection (or statements failing with driver.ErrBadConn), after which
+// it is not dialed: readers with open circuits are skipped before the ReaderSelector is consulted, and an open writer circuit fails with
+// ErrCircuitOpen. Once open for cb.OpenDuration a circuit is half-opened and probed in the background, closing again after cb.Probes
+// successful probes. The zero CircuitBreaker provides the defaults of each field.
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(d *Driver) {
+		d.breakers = newBreakers(cb)
+		d.observers = append(d.observers, breakerObserver)
+	}
+}
+
+// WithWriterFailover creates an Option that finds the primary among each cluster's writer and writer candidates (see Cluster)
+//
+// Each writer connection is checked with detect as it is opened. If the writer is not the primary (or can't be opened), the candidates
+// are tried in order, and the first found to be the primary is promoted to writer: new writer connections use it, and connections to
+// the previous writer are closed when next used. Writes rejected with an error for which readOnly reports true also start a search, and
+// readOnly may be nil to recognise both MySQLReadOnlyError and PostgresReadOnlyError.
+func WithWriterFailover(detect PrimaryDetector, readOnly ReadOnlyErrorFunc) Option {
+	if readOnly == nil {
+		readOnly = func(err error) bool {
+			return MySQLReadOnlyError(err) || PostgresReadOnlyError(err)
+		}
+	}
+	return func(d *Driver) {
+		d.failover = &failover{detect: detect, readOnly: readOnly}
+	}
+}
@@ -0,0 +1,175 @@
+package rwproxy
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+var (
+	tempTableRegexp    = regexp.MustCompile(`^create\s+(?:(?:global|local)\s+)?temp(?:orary)?\s+table\s+(?:if\s+not\s+exists\s+)?([^\s(]+)`)
+	dropTableRegexp    = regexp.MustCompile(`^drop\s+(?:temp(?:orary)?\s+)?table\s+(?:if\s+exists\s+)?([^;]+)`)
+	lockTablesRegexp   = regexp.MustCompile(`^lock\s+tables?\s`)
+	unlockTablesRegexp = regexp.MustCompile(`^unlock\s+tables?\b`)
+	namedLockRegexp    = regexp.MustCompile(`\b(get_lock|release_lock)\s*\(\s*([^,)]*)`)
+	advisoryLockRegexp = regexp.MustCompile(`\bpg_(?:try_)?advisory_(lock|unlock)(?:_shared)?\s*\(([^)]*)\)`)
+	userVariableRegexp = regexp.MustCompile(`(?:^|[^@\w])@(\w+)\s*:=|\binto\s+@(\w+)`)
+	setUserVarRegexp   = regexp.MustCompile(`(?:^|[^@\w])@(\w+)\s*:?=`)
+)
+
+const (
+	stateNamedLock    = "named lock "
+	stateAdvisoryLock = "advisory lock "
+)
+
+// sessionState provides the session-scoped state acquired by a statement, which only exists on the delegate connection it is executed on
+// (e.g. a temporary table, table lock, named or advisory lock, or user variable), and the state it releases
+//
+// States are keyed by the text of their arguments, so a lock taken with a bind parameter is only distinguished from another by the
+// parameter's placeholder. A released state ending in a space releases every state with it as a prefix, e.g. all named locks.
+func sessionState(query string) (acquired, released []string) {
+	q := strings.ToLower(strings.TrimSpace(query))
+
+	if m := tempTableRegexp.FindStringSubmatch(q); m != nil {
+		acquired = append(acquired, "temporary table "+m[1])
+	}
+	if m := dropTableRegexp.FindStringSubmatch(q); m != nil {
+		for _, table := range strings.Split(m[1], ",") {
+			if fields := strings.Fields(table); len(fields) > 0 {
+				released = append(released, "temporary table "+fields[0])
+			}
+		}
+	}
+	if lockTablesRegexp.MatchString(q) {
+		acquired = append(acquired, "table locks")
+	}
+	if unlockTablesRegexp.MatchString(q) {
+		released = append(released, "table locks")
+	}
+
+	for _, m := range namedLockRegexp.FindAllStringSubmatch(q, -1) {
+		if m[1] == "get_lock" {
+			acquired = append(acquired, stateNamedLock+strings.TrimSpace(m[2]))
+		} else {
+			released = append(released, stateNamedLock+strings.TrimSpace(m[2]))
+		}
+	}
+	if strings.Contains(q, "release_all_locks") {
+		released = append(released, stateNamedLock)
+	}
+	for _, m := range advisoryLockRegexp.FindAllStringSubmatch(q, -1) {
+		key := stateAdvisoryLock + strings.Join(strings.Fields(m[2]), "")
+		if m[1] == "lock" {
+			acquired = append(acquired, key)
+		} else {
+			released = append(released, key)
+		}
+	}
+	if strings.Contains(q, "pg_advisory_unlock_all") {
+		released = append(released, stateAdvisoryLock)
+	}
+
+	vars := userVariableRegexp
+	if strings.HasPrefix(q, "set") {
+		vars = setUserVarRegexp
+	}
+	for _, m := range vars.FindAllStringSubmatch(q, -1) {
+		name := m[1]
+		if len(m) > 2 && name == "" {
+			name = m[2]
+		}
+		acquired = append(acquired, "user variable @"+name)
+	}
+	return acquired, released
+}
+
+// reentrant reports whether a session-scoped state may be acquired more than once, needing to be released as many times, as named and
+// advisory locks may
+func reentrant(state string) bool {
+	return strings.HasPrefix(state, stateNamedLock) || strings.HasPrefix(state, stateAdvisoryLock)
+}
+
+// changesSessionState reports whether a statement acquires or releases session-scoped state
+func changesSessionState(query string) bool {
+	acquired, released := sessionState(query)
+	return len(acquired) > 0 || len(released) > 0
+}
+
+type pinnedKey struct{}
+
+// pinning provides a context routing a read to the writer if its query acquires or releases session-scoped state, e.g.
+// SELECT GET_LOCK(...)
+func pinning(ctx context.Context, query string) context.Context {
+	if changesSessionState(query) {
+		return context.WithValue(ctx, pinnedKey{}, true)
+	}
+	return ctx
+}
+
+// pinned reports whether reads are pinned to the writer, as it holds session-scoped state or the read acquires or releases some
+func (c *conn) pinned(ctx context.Context) bool {
+	pin, _ := ctx.Value(pinnedKey{}).(bool)
+	return pin || c.writerConn != nil && len(c.writerConn.pins) > 0
+}
+
+// pin records the session-scoped state acquired and released by a statement executed on a delegate connection, pinning reads to the
+// writer while it holds any
+func (c *conn) pin(pc *proxiedConn, query string, err error) {
+	if err != nil || pc.role != roleWriter {
+		return
+	}
+	acquired, released := sessionState(query)
+	if c.tx != nil {
+		// table locks taken in a transaction (e.g. PostgreSQL's LOCK TABLE) are released with it
+		for i := 0; i < len(acquired); i++ {
+			if acquired[i] == "table locks" {
+				acquired = append(acquired[:i], acquired[i+1:]...)
+				i--
+			}
+		}
+	}
+	if len(acquired) == 0 && len(released) == 0 {
+		return
+	}
+
+	wasPinned := len(pc.pins) > 0
+	for _, state := range released {
+		for held := range pc.pins {
+			switch {
+			case strings.HasSuffix(state, " ") && strings.HasPrefix(held, state):
+				delete(pc.pins, held)
+			case held == state:
+				if pc.pins[held]--; pc.pins[held] <= 0 {
+					delete(pc.pins, held)
+				}
+			}
+		}
+	}
+	for _, state := range acquired {
+		if pc.pins == nil {
+			pc.pins = map[string]int{}
+		}
+		if reentrant(state) || pc.pins[state] == 0 {
+			pc.pins[state]++
+		}
+	}
+
+	switch pinned := len(pc.pins) > 0; {
+	case pinned && !wasPinned:
+		c.driver.debugf("pinning to writer for session state: %s", strings.Join(acquired, ", "))
+		c.driver.stats.pinned(1)
+	case !pinned && wasPinned:
+		c.driver.debugf("unpinning from writer; session state released")
+		c.driver.stats.pinned(-1)
+	}
+}
+
+// unpin releases the pin of a writer connection to session-scoped state, e.g. when the session is reset
+func (c *conn) unpin(pc *proxiedConn) {
+	if pc == nil || len(pc.pins) == 0 {
+		return
+	}
+	c.driver.debugf("unpinning from writer; session reset")
+	pc.pins = nil
+	c.driver.stats.pinned(-1)
+}
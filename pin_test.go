@@ -0,0 +1,148 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestPinnedSessionState(t *testing.T) {
+	cases := []struct {
+		name    string
+		acquire string
+		release string
+	}{
+		{name: "temporary table", acquire: "CREATE TEMPORARY TABLE t (id INT)", release: "DROP TEMPORARY TABLE t"},
+		{name: "postgres temporary table", acquire: "CREATE TEMP TABLE t AS SELECT 1", release: "DROP TABLE IF EXISTS t"},
+		{name: "lock tables", acquire: "LOCK TABLES t WRITE", release: "UNLOCK TABLES"},
+		{name: "named lock", acquire: "SELECT GET_LOCK('job', 10)", release: "SELECT RELEASE_LOCK('job')"},
+		{name: "all named locks", acquire: "SELECT GET_LOCK('job', 10)", release: "SELECT RELEASE_ALL_LOCKS()"},
+		{name: "advisory lock", acquire: "SELECT pg_advisory_lock(42)", release: "SELECT pg_advisory_unlock(42)"},
+		{name: "all advisory locks", acquire: "SELECT pg_try_advisory_lock(1, 2)", release: "SELECT pg_advisory_unlock_all()"},
+		{name: "user variable", acquire: "SET @id = 1"},
+		{name: "user variable assigned by select", acquire: "SELECT MAX(id) INTO @id FROM t"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := rwproxy.New(&replicaSet{primary: "writer"})
+			conn, err := d.Open("writer;reader")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer conn.Close()
+
+			// run provides whether a statement was run on the writer
+			run := func(query string) bool {
+				t.Helper()
+				if !strings.HasPrefix(query, "SELECT") {
+					if _, err := conn.(driver.ExecerContext).ExecContext(context.Background(), query, nil); err != nil {
+						t.Fatalf("unexpected error: %s", err)
+					}
+					return true
+				}
+				rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), query, nil)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				defer rows.Close()
+				values := make([]driver.Value, 2)
+				if err := rows.Next(values); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				// the fake replica set reports @@read_only
+				return string(values[0].([]byte)) == "0"
+			}
+
+			if run("SELECT") {
+				t.Errorf("expected reads to use the reader before session state is acquired")
+			}
+			if !run(c.acquire) {
+				t.Errorf("expected %s to run on the writer", c.acquire)
+			}
+			if !run("SELECT") {
+				t.Errorf("expected reads to be pinned to the writer")
+			}
+			if stats := d.Stats(); stats.PinnedConns != 1 || stats.Pins != 1 {
+				t.Errorf("expected 1 pinned connection and 1 pin; got %d and %d", stats.PinnedConns, stats.Pins)
+			}
+
+			if c.release != "" {
+				if !run(c.release) {
+					t.Errorf("expected %s to run on the writer", c.release)
+				}
+			} else if err := conn.(driver.SessionResetter).ResetSession(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if run("SELECT") {
+				t.Errorf("expected reads to use the reader once session state is released")
+			}
+			if stats := d.Stats(); stats.PinnedConns != 0 || stats.Pins != 1 {
+				t.Errorf("expected 0 pinned connections and 1 pin; got %d and %d", stats.PinnedConns, stats.Pins)
+			}
+		})
+	}
+}
+
+func TestPinnedSessionState_reentrant(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "writer"})
+	conn, err := d.Open("writer;reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	// query provides whether a query was run on the writer
+	query := func(query string, args ...driver.NamedValue) bool {
+		t.Helper()
+		rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), query, args)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer rows.Close()
+		values := make([]driver.Value, 2)
+		if err := rows.Next(values); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return string(values[0].([]byte)) == "0"
+	}
+
+	// locks taken with bind parameters are held until released as many times as they were acquired
+	for _, name := range []string{"job-1", "job-2"} {
+		if !query("SELECT GET_LOCK(?, 10)", driver.NamedValue{Ordinal: 1, Value: name}) {
+			t.Errorf("expected GET_LOCK to run on the writer")
+		}
+	}
+	for i, name := range []string{"job-1", "job-2"} {
+		if !query("SELECT RELEASE_LOCK(?)", driver.NamedValue{Ordinal: 1, Value: name}) {
+			t.Errorf("expected RELEASE_LOCK %d to run on the writer", i+1)
+		}
+		if pinned := d.Stats().PinnedConns; pinned != 1-i {
+			t.Errorf("expected %d pinned connections after release %d; got %d", 1-i, i+1, pinned)
+		}
+	}
+	if query("SELECT") {
+		t.Errorf("expected reads to use the reader once every lock is released")
+	}
+
+	// releases run on the writer, even when nothing is held
+	if !query("SELECT pg_advisory_unlock_all()") {
+		t.Errorf("expected pg_advisory_unlock_all to run on the writer")
+	}
+}
+
+func TestPinnedSessionState_explain(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "writer"})
+	for _, query := range []string{"SELECT GET_LOCK('x', 1)", "SELECT RELEASE_LOCK('x')"} {
+		ex, err := d.Explain(context.Background(), "writer;reader", query, false, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ex.Role != "writer" || len(ex.Targets) != 1 || ex.Targets[0] != "writer" {
+			t.Errorf("expected %s to be routed to the writer; got %+v", query, ex)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package rwproxy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redacted replaces any credentials removed by RedactDSN
+const redacted = "xxxxx"
+
+var redactKeywordRegexp = regexp.MustCompile(`(?i)\b(password|passwd|pwd)(\s*=\s*)('[^']*'|[^\s;&]*)`)
+
+// RedactDSN obscures any password in a delegate DSN, so that it may be logged or displayed
+//
+// Passwords are recognised as URL/MySQL-style userinfo (user:password@…), and as password keywords (password=…).
+func RedactDSN(dsn string) string {
+	dsn = redactKeywordRegexp.ReplaceAllString(dsn, "${1}${2}"+redacted)
+
+	// userinfo precedes the last "@" before the "/dbname" of a MySQL-style DSN (as its password may contain "?", "@" or "/"), or before
+	// any query string, and follows any URL scheme
+	start := 0
+	if i := strings.Index(dsn, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	end := len(dsn)
+	if i := strings.LastIndex(dsn, "/"); start == 0 && i >= 0 {
+		end = i
+	} else if i := strings.Index(dsn[start:], "?"); i >= 0 {
+		end = start + i
+	}
+	at := strings.LastIndex(dsn[start:end], "@")
+	if at < 0 {
+		return dsn
+	}
+	userinfo := dsn[start : start+at]
+	if start > 0 && strings.Contains(userinfo, "/") {
+		// the "@" is in a URL path, rather than the authority
+		return dsn
+	}
+	colon := strings.Index(userinfo, ":")
+	if colon < 0 {
+		return dsn
+	}
+	return dsn[:start+colon+1] + redacted + dsn[start+at:]
+}
@@ -0,0 +1,81 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithReaderRetry(t *testing.T) {
+	cases := []struct {
+		name        string
+		dsn         string
+		retry       rwproxy.ReaderRetry
+		policy      rwproxy.FallbackPolicy
+		err         bool
+		readerConns map[string]int
+		fallbacks   int64
+	}{
+		{
+			name:        "single attempt",
+			dsn:         "writer;reader-1;reader-2",
+			retry:       rwproxy.ReaderRetry{},
+			readerConns: map[string]int{},
+			fallbacks:   1,
+		},
+		{
+			name:        "retried",
+			dsn:         "writer;reader-1;reader-2",
+			retry:       rwproxy.ReaderRetry{Attempts: 2, Backoff: time.Millisecond},
+			readerConns: map[string]int{"reader-2": 1},
+		},
+		{
+			name:        "no readers left to retry",
+			dsn:         "writer;reader-1",
+			retry:       rwproxy.ReaderRetry{Attempts: 3, Backoff: time.Millisecond},
+			readerConns: map[string]int{},
+			fallbacks:   1,
+		},
+		{
+			name:        "no fallback",
+			dsn:         "writer;reader-1",
+			retry:       rwproxy.ReaderRetry{Attempts: 3, Backoff: time.Millisecond},
+			policy:      rwproxy.FallbackNever,
+			err:         true,
+			readerConns: map[string]int{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := []rwproxy.Option{rwproxy.WithReaderRetry(c.retry)}
+			if c.policy != nil {
+				opts = append(opts, rwproxy.WithFallbackPolicy(c.policy))
+			}
+			d := rwproxy.New(&replicaSet{primary: "writer", down: "reader-1"}, opts...)
+			conn, err := d.Open(c.dsn)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer conn.Close()
+
+			err = conn.(driver.Pinger).Ping(context.Background())
+			if c.err && err == nil {
+				t.Errorf("expected error")
+			} else if !c.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			stats := d.Stats()
+			if len(stats.ReaderConns) != len(c.readerConns) || stats.ReaderConns["reader-2"] != c.readerConns["reader-2"] {
+				t.Errorf("expected reader connections %v; got %v", c.readerConns, stats.ReaderConns)
+			}
+			if stats.Fallbacks != c.fallbacks {
+				t.Errorf("expected %d fallbacks; got %d", c.fallbacks, stats.Fallbacks)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+)
+
+// Explanation describes how a statement or transaction would be routed, and why
+type Explanation struct {
+	// Role is the role of the connection that would be used: "writer" or "reader"
+	Role string
+	// Targets are the DSNs that could serve the statement: the writer, or the candidate readers (one of which would be chosen by the
+	// ReaderSelector). There are none if the statement would fail, as no reader is available and the writer would not be substituted.
+	Targets []string
+	// Steps are the rules, overrides and fallbacks applied to reach Role, in the order they were applied
+	Steps []string
+}
+
+// Explain describes how a new connection to the compound DSN would route a statement, without opening any connections or executing anything
+//
+// isExec distinguishes an Exec from a Query, and inTx provides the options of the transaction the statement is executed in, if any.
+// With WithShards, the compound DSN of the shard resolved from ctx is used in place of dsn, and with WithConfigFile, the cluster of the
+// configuration file. A compound DSN that hasn't been opened is explained with the readers it specifies, rather than those of any ReaderSource,
+// and without being added to the Topology.
+func (d *Driver) Explain(ctx context.Context, dsn, query string, isExec bool, inTx *driver.TxOptions) (Explanation, error) {
+	var cl *cluster
+	if d.shards != nil {
+		name, err := d.shards.resolve(ctx)
+		if err != nil {
+			return Explanation{}, err
+		}
+		var ok bool
+		if dsn, ok = d.shards.dsns[name]; !ok {
+			return Explanation{}, UnknownShardError{Name: name}
+		}
+		if cl, err = d.explainedCluster(dsn); err != nil {
+			return Explanation{}, err
+		}
+	} else if d.config != nil {
+		var err error
+		if cl, err = d.configCluster(); err != nil {
+			return Explanation{}, err
+		}
+	} else {
+		var err error
+		if cl, err = d.explainedCluster(dsn); err != nil {
+			return Explanation{}, err
+		}
+	}
+
+	d.debugf("explaining: %s", query)
+	rt := &routing{driver: d, explain: true}
+	role := routeRole(rt, isExec, inTx)
+	if role == roleReader && inTx == nil && changesSessionState(query) {
+		rt.step("query acquires or releases session-scoped state; using writer")
+		role = roleWriter
+	}
+	if role == roleReader {
+		readers, err := cl.readers(rt, ReaderGroup(hinted(ctx, query)))
+		if len(readers) > 0 {
+			return Explanation{Role: roleReader, Targets: readers, Steps: rt.steps}, nil
+		}
+		op := opQuery
+		if inTx != nil {
+			op = opBegin
+		}
+		if err != nil && !rt.fallBack(Fallback{Op: op, Err: err, Stale: err == ErrReadersStale}) {
+			return Explanation{Role: roleReader, Steps: rt.steps}, nil
+		}
+	}
+	return Explanation{Role: roleWriter, Targets: []string{cl.writer().DSN}, Steps: rt.steps}, nil
+}
+
+// explainedCluster provides the cluster of a compound DSN if it has already been opened, or otherwise parses one without sharing it, so
+// that explaining neither adds it to the Topology nor refreshes its readers from a ReaderSource
+func (d *Driver) explainedCluster(name string) (*cluster, error) {
+	if cl := d.existingCluster(name); cl != nil {
+		return cl, nil
+	}
+	return newCluster(name, d.validator)
+}
+
+// routing applies routing rules, logging each step, and recording them when explaining
+type routing struct {
+	driver  *Driver
+	explain bool
+	steps   []string
+}
+
+func (rt *routing) step(format string, args ...interface{}) {
+	rt.driver.debugf(format, args...)
+	if rt.explain {
+		rt.steps = append(rt.steps, fmt.Sprintf(format, args...))
+	}
+}
+
+// routeRole selects the role for a statement, or for beginning a transaction
+func routeRole(rt *routing, isExec bool, inTx *driver.TxOptions) string {
+	switch {
+	case inTx != nil && inTx.ReadOnly:
+		rt.step("readonly transaction; using reader")
+		return roleReader
+	case inTx != nil:
+		rt.step("read-write transaction; using writer")
+		return roleWriter
+	case isExec:
+		rt.step("exec; using writer")
+		return roleWriter
+	default:
+		rt.step("query; using reader")
+		return roleReader
+	}
+}
+
+// readers provides the candidate readers of the cluster, or none if the writer must be substituted
+//
+// If there are readers, but none are available, the reason is provided as ErrReadersStale or ErrReadersUnavailable.
+func (cl *cluster) readers(rt *routing, group string) ([]string, error) {
+	var readers []Node
+	for _, n := range cl.spec().Readers {
+		if n.group() == group {
+			readers = append(readers, n)
+		}
+	}
+	if len(readers) == 0 {
+		if group != DefaultReaderGroup {
+			rt.step("no readers in group: %s", group)
+			return nil, ErrReadersUnavailable
+		}
+		rt.step("no readers specified; substituting with writer")
+		return nil, nil
+	}
+	dsns := make([]string, 0, len(readers))
+	drained, stale := 0, 0
+	for _, n := range readers {
+		if cl.isDrained(n.DSN) {
+			rt.step("skipping drained reader: %s", n)
+			drained++
+			continue
+		}
+		if rt.driver.allow(n.DSN) != nil {
+			rt.step("skipping reader with open circuit: %s", n)
+			continue
+		}
+		if cl.isStale(n.DSN) {
+			rt.step("skipping stale reader: %s", n)
+			stale++
+			continue
+		}
+		dsns = append(dsns, n.DSN)
+	}
+	switch {
+	case len(dsns) > 0:
+		return dsns, nil
+	case stale > 0 && stale == len(readers)-drained:
+		return nil, ErrReadersStale
+	default:
+		return nil, ErrReadersUnavailable
+	}
+}
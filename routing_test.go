@@ -0,0 +1,106 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+	"github.com/nedscode/rwproxy/sqldrivermock"
+)
+
+func TestDriver_Explain(t *testing.T) {
+	cases := []struct {
+		name     string
+		dsn      string
+		isExec   bool
+		inTx     *driver.TxOptions
+		expected rwproxy.Explanation
+	}{
+		{
+			name:   "exec",
+			dsn:    "writer;reader",
+			isExec: true,
+			expected: rwproxy.Explanation{
+				Role:    "writer",
+				Targets: []string{"writer"},
+				Steps:   []string{"exec; using writer"},
+			},
+		},
+		{
+			name: "query",
+			dsn:  "writer;reader-1;reader-2",
+			expected: rwproxy.Explanation{
+				Role:    "reader",
+				Targets: []string{"reader-1", "reader-2"},
+				Steps:   []string{"query; using reader"},
+			},
+		},
+		{
+			name: "query without readers",
+			dsn:  "writer",
+			expected: rwproxy.Explanation{
+				Role:    "writer",
+				Targets: []string{"writer"},
+				Steps:   []string{"query; using reader", "no readers specified; substituting with writer"},
+			},
+		},
+		{
+			name:   "exec in readonly transaction",
+			dsn:    "writer;reader",
+			isExec: true,
+			inTx:   &driver.TxOptions{ReadOnly: true},
+			expected: rwproxy.Explanation{
+				Role:    "reader",
+				Targets: []string{"reader"},
+				Steps:   []string{"readonly transaction; using reader"},
+			},
+		},
+		{
+			name: "query in transaction",
+			dsn:  "writer;reader",
+			inTx: &driver.TxOptions{},
+			expected: rwproxy.Explanation{
+				Role:    "writer",
+				Targets: []string{"writer"},
+				Steps:   []string{"read-write transaction; using writer"},
+			},
+		},
+	}
+
+	d := rwproxy.New(sqldrivermock.New())
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ex, err := d.Explain(context.Background(), c.dsn, "SELECT", c.isExec, c.inTx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(ex, c.expected) {
+				t.Errorf("explanation mismatch: expected %+v; got %+v", c.expected, ex)
+			}
+		})
+	}
+}
+
+func TestDriver_Explain_unopened(t *testing.T) {
+	var refreshed bool
+	d := rwproxy.New(sqldrivermock.New(), rwproxy.WithReaderSource(deadlineSource{deadline: &refreshed}, 0))
+	defer d.Close()
+
+	ex, err := d.Explain(context.Background(), "writer;reader", "SELECT", false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(ex.Targets, []string{"reader"}) {
+		t.Errorf("expected the readers of the compound DSN; got %v", ex.Targets)
+	}
+
+	// explaining doesn't open the cluster
+	if topo := d.Topology(); len(topo.Clusters) != 0 {
+		t.Errorf("expected no clusters; got %+v", topo.Clusters)
+	}
+	if refreshed {
+		t.Errorf("expected the readers not to be refreshed from the ReaderSource")
+	}
+}
@@ -0,0 +1,78 @@
+package rwproxy
+
+import (
+	"database/sql/driver"
+	"io"
+	"reflect"
+)
+
+// rows wraps delegate driver.Rows, calling closed once the rows are closed
+//
+// All optional driver.Rows interfaces are implemented, delegating where the proxied rows implement them, and otherwise providing the
+// same defaults as "database/sql".
+type rows struct {
+	driver.Rows
+	closed func(err error)
+}
+
+func newRows(r driver.Rows, closed func(err error)) *rows {
+	return &rows{Rows: r, closed: closed}
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	if r.closed != nil {
+		r.closed(err)
+		r.closed = nil
+	}
+	return err
+}
+
+func (r *rows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *rows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeLength(index int) (int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypeNullable(index int) (bool, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
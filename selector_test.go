@@ -0,0 +1,79 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestLeastConnectionsReaderSelector(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "writer"}, rwproxy.WithReaderSelector(rwproxy.LeastConnectionsReaderSelector()))
+	open := func() driver.Conn {
+		t.Helper()
+		conn, err := d.Open("writer;reader-1;reader-2")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := conn.(driver.Pinger).Ping(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return conn
+	}
+	readerConns := func(expected map[string]int) {
+		t.Helper()
+		stats := d.Stats()
+		if stats.ReaderConns["reader-1"] != expected["reader-1"] || stats.ReaderConns["reader-2"] != expected["reader-2"] {
+			t.Errorf("expected reader connections %v; got %v", expected, stats.ReaderConns)
+		}
+	}
+
+	conns := []driver.Conn{open(), open(), open()}
+	readerConns(map[string]int{"reader-1": 2, "reader-2": 1})
+
+	// the reader with the fewest connections is selected, regardless of the round robin order
+	conns[0].Close()
+	conns[2].Close()
+	conns = append(conns[1:2], open())
+	readerConns(map[string]int{"reader-1": 1, "reader-2": 1})
+	conns = append(conns, open(), open())
+	readerConns(map[string]int{"reader-1": 2, "reader-2": 2})
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	readerConns(map[string]int{})
+}
+
+// openConns is a driver reporting a fixed number of open connections to each reader, without opening any, or synchronising callers
+type openConns map[string]int
+
+func (oc openConns) Open(dsn string) (driver.Conn, error) {
+	return nil, nil
+}
+
+func (oc openConns) OpenConns(dsn string) int {
+	return oc[dsn]
+}
+
+// selectConcurrently calls a ReaderSelector from many goroutines, as "database/sql" may, for the race detector to check
+func selectConcurrently(t *testing.T, rs rwproxy.ReaderSelector) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rs(context.Background(), openConns{}, []string{"reader-1", "reader-2"}); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLeastConnectionsReaderSelector_concurrent(t *testing.T) {
+	selectConcurrently(t, rwproxy.LeastConnectionsReaderSelector())
+}
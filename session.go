@@ -0,0 +1,189 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+)
+
+// session records the session settings executed on a connection (and its shards), to be replayed on every delegate connection
+type session struct {
+	settings []setting
+}
+
+// setting is a statement setting a session variable, such as SET time_zone = ...
+type setting struct {
+	name  string
+	query string
+	args  []driver.NamedValue
+}
+
+// settingName provides the name of the session variable set by a statement, if it sets one for the remainder of the session
+//
+// Statements setting global, transaction-scoped or user variables are not session settings. SET LOCAL is, as in MySQL it is a synonym
+// for SET SESSION, while in PostgreSQL it only takes effect in a transaction, in which settings are not recorded.
+func settingName(query string) (string, bool) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if !strings.HasPrefix(q, "set") || len(q) < 4 || !isSpace(q[3]) {
+		return "", false
+	}
+	q = strings.TrimSpace(q[3:])
+	for _, prefix := range []string{"global ", "@@global.", "persist", "transaction", "constraints", "password"} {
+		if strings.HasPrefix(q, prefix) {
+			return "", false
+		}
+	}
+	q = strings.TrimPrefix(q, "session ")
+	q = strings.TrimPrefix(q, "local ")
+	q = strings.TrimPrefix(q, "@@session.")
+	q = strings.TrimPrefix(q, "@@local.")
+	q = strings.TrimPrefix(q, "@@")
+	if strings.HasPrefix(q, "@") {
+		// user variable
+		return "", false
+	}
+	if strings.HasPrefix(q, "character set") {
+		return "character set", true
+	}
+
+	end := 0
+	for end < len(q) && (q[end] == '_' || q[end] == '.' || q[end] >= 'a' && q[end] <= 'z' || q[end] >= '0' && q[end] <= '9') {
+		end++
+	}
+	if end == 0 {
+		return "", false
+	}
+	if strings.Count(q, "=") > 1 {
+		// setting several variables, so only replaced by the same statement
+		return q, true
+	}
+	return q[:end], true
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// record records a session setting, replacing any earlier setting of the same variable
+func (s *session) record(name, query string, args []driver.NamedValue) {
+	for i, st := range s.settings {
+		if st.name == name {
+			s.settings = append(s.settings[:i], s.settings[i+1:]...)
+			break
+		}
+	}
+	s.settings = append(s.settings, setting{name: name, query: query, args: append([]driver.NamedValue(nil), args...)})
+}
+
+// executed records the session-scoped state acquired or released by a statement executed on a delegate connection, and if it is a
+// session setting, records it and applies it to the connection's other delegate connections
+//
+// Settings executed in a transaction are not recorded, as they may be rolled back with it.
+func (c *conn) executed(ctx context.Context, pc *proxiedConn, query string, args []driver.NamedValue, err error) {
+	c.pin(pc, query, err)
+	if err != nil || c.tx != nil {
+		return
+	}
+	name, ok := settingName(query)
+	if !ok {
+		return
+	}
+	c.driver.debugf("session setting %s; applying to every connection: %s", name, query)
+	c.session.record(name, query, args)
+	c.apply(ctx, pc, setting{name: name, query: query, args: args})
+}
+
+// apply applies a session setting to every delegate connection other than the one it was executed on, closing any writer that fails so
+// that it is reopened (and the setting replayed) when next needed
+//
+// Settings a reader rejects (e.g. privileged settings, such as sql_log_bin) are skipped, keeping the reader.
+func (c *conn) apply(ctx context.Context, executed *proxiedConn, st setting) {
+	for _, s := range c.shardConns {
+		s.apply(ctx, executed, st)
+	}
+
+	failed := func(pc *proxiedConn) bool {
+		if pc == nil || pc == executed {
+			return false
+		}
+		err := execDirect(ctx, pc.Conn, st.query, st.args)
+		if err == nil {
+			return false
+		}
+		if pc.role == roleReader {
+			c.driver.debugf("reader rejected session setting; skipping: %s: %s", pc.dsn, err)
+			return false
+		}
+		c.driver.debugf("failed to apply session setting; closing: %s: %s", pc.dsn, err)
+		if err := c.closeConn(pc); err != nil {
+			c.driver.debugf("failed to close connection: %s", err)
+		}
+		return true
+	}
+	if failed(c.writerConn) {
+		if c.readerConn == c.writerConn {
+			c.readerConn = nil
+			c.fallback = nil
+		}
+		c.writerConn = nil
+	}
+	if c.readerConn != c.writerConn && failed(c.readerConn) {
+		c.readerConn = nil
+	}
+	if failed(c.hedgeConn) {
+		c.hedgeConn = nil
+	}
+	for dsn, pc := range c.idleReaders {
+		if failed(pc) {
+			delete(c.idleReaders, dsn)
+		}
+	}
+}
+
+// replay applies the recorded session settings to a newly opened delegate connection
+//
+// Settings a reader rejects are skipped, as by apply.
+func (c *conn) replay(ctx context.Context, pc *proxiedConn) error {
+	for _, st := range c.session.settings {
+		c.driver.debugf("replaying session setting on %s: %s", pc.dsn, st.query)
+		err := execDirect(ctx, pc.Conn, st.query, st.args)
+		if err != nil && pc.role == roleReader && ctx.Err() == nil {
+			c.driver.debugf("reader rejected session setting; skipping: %s: %s", pc.dsn, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execDirect executes a statement directly on a delegate connection
+func execDirect(ctx context.Context, c driver.Conn, query string, args []driver.NamedValue) error {
+	err := driver.ErrSkip
+	if e, ok := c.(driver.ExecerContext); ok {
+		_, err = e.ExecContext(ctx, query, args)
+	}
+	if err == driver.ErrSkip {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err != nil {
+			return err
+		}
+		var s driver.Stmt
+		if s, err = c.Prepare(query); err != nil {
+			return err
+		}
+		defer s.Close()
+		_, err = s.Exec(values)
+	}
+	return err
+}
+
+// valuesToNamedValues converts positional arguments to ordinal named arguments
+func valuesToNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
@@ -0,0 +1,135 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestSessionSettings(t *testing.T) {
+	cases := []struct {
+		name    string
+		query   string
+		applied bool
+	}{
+		{name: "time zone", query: "SET time_zone = '+00:00'", applied: true},
+		{name: "search path", query: "SET search_path TO app, public", applied: true},
+		{name: "names", query: "SET NAMES utf8mb4", applied: true},
+		{name: "session scope", query: "SET SESSION sql_mode = 'ANSI'", applied: true},
+		{name: "session variable", query: "SET @@session.sql_mode = 'ANSI'", applied: true},
+		{name: "global", query: "SET GLOBAL max_connections = 100", applied: false},
+		{name: "global variable", query: "SET @@global.max_connections = 100", applied: false},
+		{name: "transaction", query: "SET TRANSACTION ISOLATION LEVEL READ COMMITTED", applied: false},
+		{name: "local scope", query: "SET LOCAL sql_mode = 'ANSI'", applied: true},
+		{name: "local variable", query: "SET @@local.sql_mode = 'ANSI'", applied: true},
+		{name: "user variable", query: "SET @id = 1", applied: false},
+		{name: "password", query: "SET PASSWORD = 'secret'", applied: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rs := &replicaSet{primary: "writer"}
+			d := rwproxy.New(rs)
+			conn, err := d.Open("writer;reader")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer conn.Close()
+
+			// open the reader before the setting is executed
+			rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			rows.Close()
+
+			if _, err := conn.(driver.ExecerContext).ExecContext(context.Background(), c.query, nil); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if settings := rs.settingsOf("writer"); !reflect.DeepEqual(settings, []string{c.query}) {
+				t.Errorf("expected setting to be executed on the writer; got %v", settings)
+			}
+			var expected []string
+			if c.applied {
+				expected = []string{c.query}
+			}
+			if settings := rs.settingsOf("reader"); !reflect.DeepEqual(settings, expected) {
+				t.Errorf("expected %v on the reader; got %v", expected, settings)
+			}
+		})
+	}
+}
+
+func TestSessionSettingsReplayed(t *testing.T) {
+	rs := &replicaSet{primary: "writer"}
+	d := rwproxy.New(rs)
+	conn, err := d.Open("writer;reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	exec := func(query string) {
+		t.Helper()
+		if _, err := conn.(driver.ExecerContext).ExecContext(context.Background(), query, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	exec("SET time_zone = '+10:00'")
+	exec("SET NAMES utf8mb4")
+	exec("SET time_zone = '+00:00'")
+
+	// a reader opened later has the latest value of each setting replayed
+	rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+
+	expected := []string{"SET NAMES utf8mb4", "SET time_zone = '+00:00'"}
+	if settings := rs.settingsOf("reader"); !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %v; got %v", expected, settings)
+	}
+}
+
+func TestSessionSettingsRejectedByReader(t *testing.T) {
+	for _, open := range []bool{false, true} {
+		rs := &replicaSet{primary: "writer"}
+		d := rwproxy.New(rs, rwproxy.WithFallbackPolicy(rwproxy.FallbackNever))
+		conn, err := d.Open("writer;reader")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		query := func() {
+			t.Helper()
+			rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			rows.Close()
+		}
+		if open {
+			query()
+		}
+		for _, setting := range []string{"SET sql_log_bin = 0", "SET time_zone = '+00:00'"} {
+			if _, err := conn.(driver.ExecerContext).ExecContext(context.Background(), setting, nil); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+
+		// the reader is kept, with only the settings it accepts, whether it was opened before or after they were executed
+		query()
+		query()
+		if stats := d.Stats(); stats.ReaderConns["reader"] != 1 || stats.Fallbacks != 0 {
+			t.Errorf("expected the reader to be kept; got %v and %d fallbacks", stats.ReaderConns, stats.Fallbacks)
+		}
+		if settings := rs.settingsOf("reader"); !reflect.DeepEqual(settings, []string{"SET time_zone = '+00:00'"}) {
+			t.Errorf("expected only the accepted setting on the reader; got %v", settings)
+		}
+		conn.Close()
+	}
+}
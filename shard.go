@@ -0,0 +1,126 @@
+package rwproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrNoShard is provided when the shard of a statement or transaction can't be resolved from its context
+var ErrNoShard = errors.New("rwproxy: no shard key")
+
+// ErrShardedReaderSource is provided when a connection is opened with both WithShards and WithReaderSource, as every shard would be
+// given the same readers
+var ErrShardedReaderSource = errors.New("rwproxy: a ReaderSource can't provide the readers of shards")
+
+// UnknownShardError is provided when a ShardResolver resolves a shard that was not provided to WithShards
+type UnknownShardError struct {
+	Name string
+}
+
+func (e UnknownShardError) Error() string {
+	return fmt.Sprintf("rwproxy: unknown shard %#v", e.Name)
+}
+
+// ShardResolver resolves the name of the shard for a statement or transaction from its context, e.g. from its ShardKey
+type ShardResolver func(ctx context.Context) (string, error)
+
+type shardKey struct{}
+
+// WithShardKey provides a context whose statements and transactions are routed to the shard resolved from key (see WithShards)
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKey{}, key)
+}
+
+// ShardKey provides the shard key of a context, if it has one (see WithShardKey)
+func ShardKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(shardKey{}).(string)
+	return key, ok
+}
+
+// ShardKeyResolver is a ShardResolver resolving the shard named by the ShardKey of the context, and is the default
+func ShardKeyResolver(ctx context.Context) (string, error) {
+	if key, ok := ShardKey(ctx); ok {
+		return key, nil
+	}
+	return "", ErrNoShard
+}
+
+// shards are the clusters that statements are routed between, by name, as configured by WithShards
+type shards struct {
+	dsns    map[string]string
+	names   []string
+	resolve ShardResolver
+}
+
+func newShards(dsns map[string]string, resolve ShardResolver) *shards {
+	if resolve == nil {
+		resolve = ShardKeyResolver
+	}
+	s := &shards{dsns: make(map[string]string, len(dsns)), resolve: resolve}
+	for name, dsn := range dsns {
+		s.dsns[name] = dsn
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+// openShards validates the compound DSN of every shard, sharing a cluster for each
+func (d *Driver) openShards() error {
+	if d.readerSource != nil {
+		return ErrShardedReaderSource
+	}
+	for _, name := range d.shards.names {
+		if _, err := d.compoundCluster(d.shards.dsns[name]); err != nil {
+			return fmt.Errorf("rwproxy: shard %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// shard provides the connection to the shard resolved from the context, opening it if necessary
+func (c *conn) shard(ctx context.Context) (*conn, error) {
+	name, err := c.driver.shards.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.shardConn(name)
+}
+
+// shardConn provides the connection to a shard by name, opening it if necessary
+func (c *conn) shardConn(name string) (*conn, error) {
+	if s, ok := c.shardConns[name]; ok {
+		return s, nil
+	}
+	dsn, ok := c.driver.shards.dsns[name]
+	if !ok {
+		return nil, UnknownShardError{Name: name}
+	}
+	cl, err := c.driver.compoundCluster(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c.driver.debugf("routing to shard: %s", name)
+	s := &conn{driver: c.driver, cluster: cl, session: c.session}
+	c.shardConns[name] = s
+	return s, nil
+}
+
+// pingShards pings every shard, or only the shard resolved from the context if it has one
+func (c *conn) pingShards(ctx context.Context) error {
+	if s, err := c.shard(ctx); err == nil {
+		return s.Ping(ctx)
+	}
+	for _, name := range c.driver.shards.names {
+		s, err := c.shardConn(name)
+		if err != nil {
+			return err
+		}
+		if err := s.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
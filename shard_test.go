@@ -0,0 +1,109 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestWithShards(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "eu-writer"}, rwproxy.WithShards(map[string]string{
+		"eu": "eu-writer;eu-reader",
+		"us": "us-writer;us-reader",
+	}, nil))
+	conn, err := d.Open("ignored")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	eu := rwproxy.WithShardKey(context.Background(), "eu")
+	if _, err := conn.(driver.ExecerContext).ExecContext(eu, "UPDATE", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	us := rwproxy.WithShardKey(context.Background(), "us")
+	rows, err := conn.(driver.QueryerContext).QueryContext(us, "SELECT", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+
+	stats := d.Stats()
+	if len(stats.WriterConns) != 1 || stats.WriterConns["eu-writer"] != 1 {
+		t.Errorf("expected a connection to eu-writer; got %v", stats.WriterConns)
+	}
+	if len(stats.ReaderConns) != 1 || stats.ReaderConns["us-reader"] != 1 {
+		t.Errorf("expected a connection to us-reader; got %v", stats.ReaderConns)
+	}
+
+	// the shard must be resolved
+	if _, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT", nil); err != rwproxy.ErrNoShard {
+		t.Errorf("expected %s; got %v", rwproxy.ErrNoShard, err)
+	}
+	_, err = conn.(driver.QueryerContext).QueryContext(rwproxy.WithShardKey(context.Background(), "ap"), "SELECT", nil)
+	if _, ok := err.(rwproxy.UnknownShardError); !ok {
+		t.Errorf("expected UnknownShardError; got %v", err)
+	}
+
+	// pinging without a shard pings every shard
+	if err := conn.(driver.Pinger).Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	stats = d.Stats()
+	if len(stats.WriterConns) != 2 || len(stats.ReaderConns) != 2 {
+		t.Errorf("expected connections to every shard; got %v and %v", stats.WriterConns, stats.ReaderConns)
+	}
+
+	e, err := d.Explain(us, "", "UPDATE", true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(e.Targets) != 1 || e.Targets[0] != "us-writer" {
+		t.Errorf("expected target us-writer; got %v", e.Targets)
+	}
+
+	conn.Close()
+	if stats := d.Stats(); len(stats.WriterConns) != 0 || len(stats.ReaderConns) != 0 {
+		t.Errorf("expected no connections; got %v and %v", stats.WriterConns, stats.ReaderConns)
+	}
+}
+
+func TestWithShards_topologyChanges(t *testing.T) {
+	d := rwproxy.New(&replicaSet{primary: "eu-writer"}, rwproxy.WithShards(map[string]string{
+		"eu": "eu-writer;eu-reader",
+		"us": "us-writer;us-reader",
+	}, nil))
+	conn, err := d.Open("ignored")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+	if err := conn.(driver.Pinger).Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := d.SetWriter("eu", rwproxy.Node{DSN: "new-eu-writer"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// only the named shard is changed
+	for shard, expected := range map[string]string{"eu": "new-eu-writer", "us": "us-writer"} {
+		e, err := d.Explain(rwproxy.WithShardKey(context.Background(), shard), "", "UPDATE", true, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(e.Targets) != 1 || e.Targets[0] != expected {
+			t.Errorf("expected %s writer %s; got %v", shard, expected, e.Targets)
+		}
+	}
+}
+
+func TestWithShards_readerSource(t *testing.T) {
+	d := rwproxy.New(&replicaSet{}, rwproxy.WithShards(map[string]string{"eu": "eu-writer"}, nil),
+		rwproxy.WithReaderSource(rwproxy.DNSReaderSource{Name: "replicas.internal"}, 0))
+	if _, err := d.Open("ignored"); err != rwproxy.ErrShardedReaderSource {
+		t.Errorf("expected %s; got %v", rwproxy.ErrShardedReaderSource, err)
+	}
+}
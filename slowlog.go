@@ -0,0 +1,45 @@
+package rwproxy
+
+import (
+	"time"
+)
+
+// SlowQuery describes a statement that took longer than the slow query threshold
+type SlowQuery struct {
+	Query string
+	// Role is the role of the connection that served the statement: "writer" or "reader"
+	Role string
+	// DSN is the delegate DSN that served the statement, redacted by RedactDSN
+	DSN string
+	// Path is "stmt" if the statement was executed via a prepared statement, or "conn" if via the connection fast-path
+	Path string
+	// Exec reports whether the statement was an exec, rather than a query
+	Exec bool
+
+	// Duration is the time until the statement returned its result or rows
+	Duration time.Duration
+	// RowsDuration is the time spent streaming rows, until the rows were closed
+	RowsDuration time.Duration
+	Err          error
+}
+
+// SlowQueryLog is a function that is called with each statement exceeding the slow query threshold
+type SlowQueryLog func(SlowQuery)
+
+func slowQueryObserver(threshold time.Duration, l SlowQueryLog) observer {
+	return func(o *observation) {
+		if o.duration+o.rowsDuration < threshold {
+			return
+		}
+		l(SlowQuery{
+			Query:        o.query,
+			Role:         o.role,
+			DSN:          RedactDSN(o.dsn),
+			Path:         o.path,
+			Exec:         o.exec,
+			Duration:     o.duration,
+			RowsDuration: o.rowsDuration,
+			Err:          o.err,
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package rwproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReaderSource provides the readers of a cluster, which may change over time
+//
+// When a ReaderSource is in use, the readers it provides replace those of the compound DSN (or configuration file).
+type ReaderSource interface {
+	Readers(ctx context.Context) ([]Node, error)
+}
+
+// Resolver resolves DNS names for a DNSReaderSource, and is implemented by *net.Resolver
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSReaderSource is a ReaderSource that resolves readers from DNS, either as the addresses of a (multi-A/AAAA) hostname, or as the
+// targets of SRV records
+type DNSReaderSource struct {
+	// Name is the DNS name to resolve
+	Name string
+	// Service and Proto, if set, resolve the SRV records of _service._proto.Name rather than the addresses of Name
+	Service string
+	Proto   string
+	// Port is the port of each address resolved from a hostname (SRV records provide their own)
+	Port int
+	// Template is the delegate DSN of each reader, in which {host}, {port} and {addr} (host:port) are replaced, e.g.
+	// "user:password@tcp({addr})/db"
+	Template string
+	// Resolver resolves Name, and is net.DefaultResolver if nil
+	Resolver Resolver
+}
+
+// Readers resolves the current readers, named by their address and ordered by DSN
+func (s DNSReaderSource) Readers(ctx context.Context) ([]Node, error) {
+	r := s.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	type hostPort struct {
+		host string
+		port int
+	}
+	var addrs []hostPort
+	if s.Service != "" || s.Proto != "" {
+		_, srvs, err := r.LookupSRV(ctx, s.Service, s.Proto, s.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			addrs = append(addrs, hostPort{host: strings.TrimSuffix(srv.Target, "."), port: int(srv.Port)})
+		}
+	} else {
+		hosts, err := r.LookupHost(ctx, s.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			addrs = append(addrs, hostPort{host: host, port: s.Port})
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("rwproxy: no readers resolved for %s", s.Name)
+	}
+
+	nodes := make([]Node, len(addrs))
+	for i, a := range addrs {
+		port := strconv.Itoa(a.port)
+		addr := net.JoinHostPort(a.host, port)
+		dsn := strings.NewReplacer("{host}", a.host, "{port}", port, "{addr}", addr).Replace(s.Template)
+		nodes[i] = Node{Name: addr, DSN: dsn}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].DSN < nodes[j].DSN })
+	return nodes, nil
+}
+
+// readerSourceTimeout bounds each refresh of a ReaderSource, including the first as a cluster is opened
+const readerSourceTimeout = 5 * time.Second
+
+// readerSource is a ReaderSource, and the interval at which it is refreshed
+type readerSource struct {
+	ReaderSource
+	interval time.Duration
+}
+
+// refreshReaders replaces the readers of each cluster with those of the ReaderSource
+func (d *Driver) refreshReaders() {
+	for _, cl := range d.openedClusters() {
+		d.refreshClusterReaders(cl)
+	}
+}
+
+func (d *Driver) refreshClusterReaders(cl *cluster) {
+	timeout := readerSourceTimeout
+	if interval := d.readerSource.interval; interval > 0 && interval < timeout {
+		timeout = interval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	readers, err := d.readerSource.Readers(ctx)
+	if err != nil {
+		d.debugf("failed to refresh readers; retaining current readers: %s", err)
+		return
+	}
+	c := cl.spec()
+	c.Readers = readers
+	if err := c.Validate(d.validator); err != nil {
+		d.debugf("refreshed readers are invalid; retaining current readers: %s", err)
+		return
+	}
+	if sameReaders(cl.spec().Readers, readers) {
+		return
+	}
+	for _, dsn := range cl.setReaders(readers) {
+		d.debugf("reader removed; connections will be closed when next used: %s", dsn)
+	}
+}
+
+func sameReaders(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].DSN != b[i].DSN || a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package rwproxy_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+	"github.com/nedscode/rwproxy/sqldrivermock"
+)
+
+type fakeResolver struct {
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	cname := "_" + service + "._" + proto + "." + name
+	if srvs, ok := r.srvs[cname]; ok {
+		return cname, srvs, nil
+	}
+	return "", nil, &net.DNSError{Err: "no such host", Name: cname, IsNotFound: true}
+}
+
+func TestDNSReaderSource(t *testing.T) {
+	resolver := fakeResolver{
+		hosts: map[string][]string{"replicas.internal": {"10.0.0.2", "10.0.0.1", "fd00::3"}},
+		srvs: map[string][]*net.SRV{"_mysql._tcp.replicas.internal": {
+			{Target: "replica-b.internal.", Port: 3307},
+			{Target: "replica-a.internal.", Port: 3306},
+		}},
+	}
+
+	cases := []struct {
+		name     string
+		source   rwproxy.DNSReaderSource
+		expected []rwproxy.Node
+	}{
+		{
+			name:   "hostname",
+			source: rwproxy.DNSReaderSource{Name: "replicas.internal", Port: 3306, Template: "user@tcp({addr})/db", Resolver: resolver},
+			expected: []rwproxy.Node{
+				{Name: "10.0.0.1:3306", DSN: "user@tcp(10.0.0.1:3306)/db"},
+				{Name: "10.0.0.2:3306", DSN: "user@tcp(10.0.0.2:3306)/db"},
+				{Name: "[fd00::3]:3306", DSN: "user@tcp([fd00::3]:3306)/db"},
+			},
+		},
+		{
+			name:   "SRV",
+			source: rwproxy.DNSReaderSource{Name: "replicas.internal", Service: "mysql", Proto: "tcp", Template: "host={host} port={port}", Resolver: resolver},
+			expected: []rwproxy.Node{
+				{Name: "replica-a.internal:3306", DSN: "host=replica-a.internal port=3306"},
+				{Name: "replica-b.internal:3307", DSN: "host=replica-b.internal port=3307"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nodes, err := c.source.Readers(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(nodes, c.expected) {
+				t.Errorf("readers mismatch: expected %+v; got %+v", c.expected, nodes)
+			}
+		})
+	}
+
+	if _, err := (rwproxy.DNSReaderSource{Name: "missing.internal", Resolver: resolver}).Readers(context.Background()); err == nil {
+		t.Errorf("expected error resolving missing name")
+	}
+}
+
+func TestWithReaderSource(t *testing.T) {
+	source := rwproxy.DNSReaderSource{
+		Name:     "replicas.internal",
+		Port:     3306,
+		Template: "tcp({addr})",
+		Resolver: fakeResolver{hosts: map[string][]string{"replicas.internal": {"10.0.0.1"}}},
+	}
+	d := rwproxy.New(sqldrivermock.New(), rwproxy.WithReaderSource(source, 0))
+	defer d.Close()
+
+	c, err := d.Open("writer;static-reader")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+
+	ex, err := d.Explain(context.Background(), "writer;static-reader", "SELECT", false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"tcp(10.0.0.1:3306)"}; !reflect.DeepEqual(ex.Targets, expected) {
+		t.Errorf("targets mismatch: expected %v; got %v", expected, ex.Targets)
+	}
+}
+
+// deadlineSource is a ReaderSource recording whether it is provided a context with a deadline
+type deadlineSource struct {
+	deadline *bool
+}
+
+func (s deadlineSource) Readers(ctx context.Context) ([]rwproxy.Node, error) {
+	_, *s.deadline = ctx.Deadline()
+	return []rwproxy.Node{{DSN: "reader"}}, nil
+}
+
+func TestWithReaderSource_timeout(t *testing.T) {
+	var deadline bool
+	d := rwproxy.New(sqldrivermock.New(), rwproxy.WithReaderSource(deadlineSource{deadline: &deadline}, 0))
+	defer d.Close()
+
+	c, err := d.Open("writer")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+	if !deadline {
+		t.Errorf("expected the readers to be refreshed with a deadline")
+	}
+}
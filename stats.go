@@ -0,0 +1,188 @@
+package rwproxy
+
+import (
+	"sync"
+)
+
+// Stats is a snapshot of the delegate connections held, and the routing performed, by a Driver
+//
+// Unlike sql.DBStats, which only describes the rwproxy connections, Stats describes the connections held open against each backend.
+type Stats struct {
+	// WriterConns is the number of open writer delegate connections, by DSN
+	WriterConns map[string]int
+	// ReaderConns is the number of open reader delegate connections, by DSN
+	ReaderConns map[string]int
+
+	// WriterTxs is the number of transactions in progress on writer connections
+	WriterTxs int
+	// ReaderTxs is the number of transactions in progress on reader connections
+	ReaderTxs int
+
+	// Stmts is the number of delegate prepared statements held open
+	Stmts int
+
+	// WriterRoutes is the cumulative number of statements and transactions routed to a writer
+	WriterRoutes int64
+	// ReaderRoutes is the cumulative number of statements and transactions routed to a reader
+	ReaderRoutes int64
+	// Fallbacks is the cumulative number of times a reader was unavailable, and a writer was used instead
+	Fallbacks int64
+	// Hedges is the cumulative number of queries repeated on a second reader, as the first was slow to respond
+	Hedges int64
+	// PinnedConns is the number of writer delegate connections holding session-scoped state (such as a temporary table or lock), to
+	// which reads are pinned
+	PinnedConns int
+	// Pins is the cumulative number of times reads were pinned to a writer by session-scoped state
+	Pins int64
+}
+
+// Stats returns a snapshot of the delegate connections and routing of the Driver
+func (d *Driver) Stats() Stats {
+	return d.stats.snapshot()
+}
+
+type stats struct {
+	mu sync.Mutex
+
+	writerConns map[string]int
+	readerConns map[string]int
+	writerTxs   int
+	readerTxs   int
+	stmts       int
+
+	writerRoutes int64
+	readerRoutes int64
+	fallbacks    int64
+	hedges       int64
+	pinnedConns  int
+	pins         int64
+}
+
+func newStats() *stats {
+	return &stats{writerConns: map[string]int{}, readerConns: map[string]int{}}
+}
+
+func (s *stats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Stats{
+		WriterConns:  copyCounts(s.writerConns),
+		ReaderConns:  copyCounts(s.readerConns),
+		WriterTxs:    s.writerTxs,
+		ReaderTxs:    s.readerTxs,
+		Stmts:        s.stmts,
+		WriterRoutes: s.writerRoutes,
+		ReaderRoutes: s.readerRoutes,
+		Fallbacks:    s.fallbacks,
+		Hedges:       s.hedges,
+		PinnedConns:  s.pinnedConns,
+		Pins:         s.pins,
+	}
+}
+
+func (s *stats) connOpened(pc *proxiedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pc.role == roleWriter {
+		s.writerConns[pc.dsn]++
+	} else {
+		s.readerConns[pc.dsn]++
+	}
+}
+
+func (s *stats) connClosed(pc *proxiedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := s.readerConns
+	if pc.role == roleWriter {
+		counts = s.writerConns
+	}
+	if counts[pc.dsn]--; counts[pc.dsn] <= 0 {
+		delete(counts, pc.dsn)
+	}
+	if len(pc.pins) > 0 {
+		s.pinnedConns--
+	}
+}
+
+func (s *stats) readerConnCount(dsn string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readerConns[dsn]
+}
+
+func (s *stats) txBegun(pc *proxiedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pc.role == roleWriter {
+		s.writerTxs++
+	} else {
+		s.readerTxs++
+	}
+}
+
+func (s *stats) txClosed(pc *proxiedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pc.role == roleWriter {
+		s.writerTxs--
+	} else {
+		s.readerTxs--
+	}
+}
+
+func (s *stats) stmtsPrepared(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stmts += n
+}
+
+func (s *stats) routed(pc *proxiedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pc.role == roleWriter {
+		s.writerRoutes++
+	} else {
+		s.readerRoutes++
+	}
+}
+
+func (s *stats) fellBack() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallbacks++
+}
+
+func (s *stats) hedged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hedges++
+}
+
+func (s *stats) pinned(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pinnedConns += n
+	if n > 0 {
+		s.pins++
+	}
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	c := make(map[string]int, len(counts))
+	for k, v := range counts {
+		c[k] = v
+	}
+	return c
+}
@@ -52,12 +52,19 @@ func (s *stmt) Close() error {
 	}
 
 	var errs []error
-	for _, proxiedStmt := range s.proxiedStmts {
+	for pc, proxiedStmt := range s.proxiedStmts {
+		if pc.(*proxiedConn).closed {
+			// the statement was closed along with its connection
+			continue
+		}
 		s.conn.driver.debugf("closing statement: %s", s.query)
 		if err := proxiedStmt.Close(); err != nil {
 			errs = append(errs, err)
 		}
 	}
+	s.conn.driver.stats.stmtsPrepared(-len(s.proxiedStmts))
+	// closing again is a no-op
+	s.proxiedStmts = map[driver.Conn]driver.Stmt{}
 	if len(errs) > 0 {
 		return ProxiedStatementCloseError{Errs: errs}
 	}
@@ -90,12 +97,16 @@ func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ps.Exec(args)
+	s.conn.driver.decided("exec", c)
+	res, err := s.conn.driver.observe(c, pathStmt, s.query, true).withValues(args).result(ps.Exec(args))
+	s.conn.driver.writeFailed(context.Background(), c, err)
+	s.conn.executed(context.Background(), c, s.query, valuesToNamedValues(args), err)
+	return res, err
 }
 
 // Query executes a query that may return rows against the reader
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
-	c, err := s.conn.reader(context.Background())
+	c, err := s.conn.reader(pinning(hinted(context.Background(), s.query), s.query), opQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +115,11 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ps.Query(args)
+	s.conn.driver.decided("query", c)
+	o := s.conn.driver.observe(c, pathStmt, s.query, false).withValues(args)
+	rows, err := ps.Query(args)
+	s.conn.pin(c, s.query, err)
+	return o.rows(rows, err)
 }
 
 // ExecContext executes a query that doesn't return rows against the writer
@@ -118,20 +133,27 @@ func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (drive
 	if err != nil {
 		return nil, err
 	}
+	s.conn.driver.decided("exec", c)
 
+	o := s.conn.driver.observe(c, pathStmt, s.query, true).withNamedValues(args)
+	var res driver.Result
 	if e, ok := ps.(driver.StmtExecContext); ok {
-		return e.ExecContext(ctx, args)
-	}
-	argValues, err := namedValuesToValues(args)
-	if err != nil {
-		return nil, err
+		res, err = o.result(e.ExecContext(ctx, args))
+	} else {
+		var argValues []driver.Value
+		if argValues, err = namedValuesToValues(args); err != nil {
+			return nil, err
+		}
+		res, err = o.result(ps.Exec(argValues))
 	}
-	return ps.Exec(argValues)
+	s.conn.driver.writeFailed(ctx, c, err)
+	s.conn.executed(ctx, c, s.query, args, err)
+	return res, err
 }
 
 // QueryContext executes a query that may return rows against the reader
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	c, err := s.conn.reader(ctx)
+	c, err := s.conn.reader(pinning(hinted(ctx, s.query), s.query), opQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -140,15 +162,21 @@ func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driv
 	if err != nil {
 		return nil, err
 	}
+	s.conn.driver.decided("query", c)
 
+	o := s.conn.driver.observe(c, pathStmt, s.query, false).withNamedValues(args)
+	var rows driver.Rows
 	if e, ok := ps.(driver.StmtQueryContext); ok {
-		return e.QueryContext(ctx, args)
-	}
-	argValues, err := namedValuesToValues(args)
-	if err != nil {
-		return nil, err
+		rows, err = e.QueryContext(ctx, args)
+	} else {
+		var argValues []driver.Value
+		if argValues, err = namedValuesToValues(args); err != nil {
+			return nil, err
+		}
+		rows, err = ps.Query(argValues)
 	}
-	return ps.Query(argValues)
+	s.conn.pin(c, s.query, err)
+	return o.rows(rows, err)
 }
 
 func (s *stmt) prepared(ctx context.Context, pc *proxiedConn) (driver.Stmt, error) {
@@ -159,6 +187,7 @@ func (s *stmt) prepared(ctx context.Context, pc *proxiedConn) (driver.Stmt, erro
 			return nil, err
 		}
 		s.proxiedStmts[pc] = ps
+		s.conn.driver.stats.stmtsPrepared(1)
 	}
 	return s.proxiedStmts[pc], nil
 }
@@ -0,0 +1,218 @@
+package rwproxy
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// maxDecisions is the number of recent routing decisions retained for Topology
+const maxDecisions = 64
+
+// Topology is a snapshot of the clusters a Driver has been opened against, and how it has been routing to them
+type Topology struct {
+	// Clusters are the clusters opened by the Driver, in the order they were first opened
+	Clusters []ClusterTopology
+	// Selector is the name of the ReaderSelector (or Balancer) in use
+	Selector string
+	// Stats are the delegate connection and routing statistics of the Driver
+	Stats Stats
+	// Decisions are the most recent routing decisions, oldest first
+	Decisions []Decision
+}
+
+// ClusterTopology describes a writer and its readers, as specified by a compound DSN
+type ClusterTopology struct {
+	Writer     NodeTopology
+	Readers    []NodeTopology
+	Candidates []NodeTopology
+	// Degraded reports whether the cluster is in degraded mode, as its writer is unavailable
+	Degraded bool
+}
+
+// NodeTopology describes a single writer or reader
+type NodeTopology struct {
+	Name   string
+	DSN    string
+	Weight int
+	Zone   string
+	// Group is the reader group of a reader
+	Group string
+	// Drained reports whether the reader has been drained by Driver.DrainReader
+	Drained bool
+	// Healthy reports whether the most recent attempt to open a connection succeeded (or none has been attempted)
+	Healthy bool
+	// LastError is the error from the most recent failed attempt to open a connection, if any
+	LastError string
+	// Circuit is the state of the node's circuit breaker, when WithCircuitBreaker is in use
+	Circuit string
+	// Lag is the most recently measured replication lag of a reader, when WithLagProbe is in use
+	Lag time.Duration
+	// Stale reports whether a reader's lag exceeds the maximum, or can't be measured, when WithLagProbe is in use
+	Stale bool
+}
+
+// Decision is a record of a statement or transaction being routed to a delegate connection
+type Decision struct {
+	Time time.Time
+	// Op is the operation being routed, e.g. "query", "exec" or "begin"
+	Op   string
+	Role string
+	DSN  string
+}
+
+// Topology returns a snapshot of the clusters the Driver has opened, their health, and recent routing decisions
+func (d *Driver) Topology() Topology {
+	clusters := d.openedClusters()
+
+	d.mu.Lock()
+	decisions := make([]Decision, 0, len(d.decisions))
+	for i := range d.decisions {
+		if dec := d.decisions[(d.nextDecision+i)%len(d.decisions)]; !dec.Time.IsZero() {
+			decisions = append(decisions, dec)
+		}
+	}
+	d.mu.Unlock()
+
+	t := Topology{
+		Clusters:  make([]ClusterTopology, len(clusters)),
+		Selector:  balancerName(d.balancer),
+		Stats:     d.Stats(),
+		Decisions: decisions,
+	}
+	for i, cl := range clusters {
+		spec := cl.spec()
+		ct := ClusterTopology{Writer: d.nodeTopology(spec.Writer), Readers: make([]NodeTopology, len(spec.Readers)), Degraded: cl.isDegraded()}
+		for j, n := range spec.Readers {
+			ct.Readers[j] = d.nodeTopology(n)
+			ct.Readers[j].Group = n.group()
+			ct.Readers[j].Drained = cl.isDrained(n.DSN)
+			ct.Readers[j].Stale = cl.isStale(n.DSN)
+			if d.lagProbes != nil {
+				ct.Readers[j].Lag, _ = d.lagProbes.lag(n.DSN)
+			}
+		}
+		for _, n := range spec.Candidates {
+			ct.Candidates = append(ct.Candidates, d.nodeTopology(n))
+		}
+		t.Clusters[i] = ct
+	}
+	return t
+}
+
+// cluster returns the (shared) cluster for a compound DSN, parsing it if it has not yet been opened
+//
+// If a configuration file is in use, its cluster is returned regardless of the compound DSN.
+func (d *Driver) cluster(name string) (*cluster, error) {
+	if d.config != nil {
+		return d.configCluster()
+	}
+	return d.compoundCluster(name)
+}
+
+// compoundCluster provides the cluster of a compound DSN, shared with all connections opened against it
+func (d *Driver) compoundCluster(name string) (*cluster, error) {
+	if cl := d.existingCluster(name); cl != nil {
+		return cl, nil
+	}
+	cl, err := newCluster(name, d.validator)
+	if err != nil {
+		return nil, err
+	}
+	return d.registerCluster(name, cl), nil
+}
+
+// registerCluster shares a cluster with all connections opened against the same name, returning any already registered in its place
+func (d *Driver) registerCluster(name string, cl *cluster) *cluster {
+	d.mu.Lock()
+	if existing, exists := d.clusters[name]; exists {
+		d.mu.Unlock()
+		return existing
+	}
+	d.clusters[name] = cl
+	d.clusterOrder = append(d.clusterOrder, cl)
+	d.mu.Unlock()
+
+	if d.readerSource != nil {
+		d.refreshClusterReaders(cl)
+	}
+	return cl
+}
+
+// existingCluster returns the cluster for a compound DSN if it has already been opened, or nil
+func (d *Driver) existingCluster(name string) *cluster {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.clusters[name]
+}
+
+func (d *Driver) nodeTopology(n Node) NodeTopology {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	nt := NodeTopology{Name: n.Name, DSN: n.DSN, Weight: n.Weight, Zone: n.Zone, Healthy: true}
+	if err := d.dialErrs[n.DSN]; err != nil {
+		nt.Healthy = false
+		nt.LastError = err.Error()
+	}
+	if d.breakers != nil {
+		nt.Circuit = d.breakers.state(n.DSN)
+	}
+	return nt
+}
+
+// dialed records the outcome of opening a delegate connection
+func (d *Driver) dialed(dsn string, err error) {
+	d.tripped(dsn, err)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err != nil {
+		d.dialErrs[dsn] = err
+	} else {
+		delete(d.dialErrs, dsn)
+	}
+}
+
+// decided records a routing decision
+func (d *Driver) decided(op string, pc *proxiedConn) {
+	d.stats.routed(pc)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.decisions[d.nextDecision] = Decision{Time: time.Now(), Op: op, Role: pc.role, DSN: pc.dsn}
+	d.nextDecision = (d.nextDecision + 1) % len(d.decisions)
+}
+
+// balancerName provides a readable name for a Balancer, or the ReaderSelector it adapts
+func balancerName(b Balancer) string {
+	if s, ok := b.(selectorBalancer); ok {
+		return funcName(s.ReaderSelector)
+	}
+	name := fmt.Sprintf("%T", b)
+	return strings.TrimPrefix(name[strings.LastIndex(name, "/")+1:], "*")
+}
+
+// funcName provides a readable name for a function value, such as a ReaderSelector
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+	name := f.Name()
+	// trim the package path, and any closure suffixes (e.g. RoundRobinReaderSelector.func1)
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,64 @@
+package rwproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+)
+
+// ZoneEnv is the environment variable providing the local zone to ZoneReaderSelector, when not given one
+const ZoneEnv = "RWPROXY_ZONE"
+
+// NodeLookup is implemented by the driver.Driver provided to a ReaderSelector, describing a reader (e.g. its Zone) by its DSN
+type NodeLookup interface {
+	LookupNode(dsn string) (Node, bool)
+}
+
+// ZoneReaderSelector implements a strategy preferring readers in the local zone (see Node.Zone), e.g. to avoid paying for cross-zone
+// traffic, selecting between readers of the same preference with next (or round robin, when nil)
+//
+// zone defaults to the ZoneEnv environment variable. A local reader with capacity (or more) delegate connections open from this
+// process is over capacity, unless capacity is 0. Readers in other zones are only selected when every local reader is unavailable,
+// fails to open or is over capacity, and local readers over capacity only when every reader in other zones fails to open.
+func ZoneReaderSelector(zone string, capacity int, next ReaderSelector) ReaderSelector {
+	if zone == "" {
+		zone = os.Getenv(ZoneEnv)
+	}
+	// each preference is selected between separately, so that e.g. round robin is not skewed by a failing local reader
+	selectors := [...]ReaderSelector{next, next, next}
+	if next == nil {
+		selectors = [...]ReaderSelector{RoundRobinReaderSelector(), RoundRobinReaderSelector(), RoundRobinReaderSelector()}
+	}
+	return func(ctx context.Context, d driver.Driver, dsns []string) (driver.Conn, error) {
+		nl, _ := d.(NodeLookup)
+		cc, _ := d.(ConnCounter)
+
+		var local, remote, overCapacity []string
+		for _, dsn := range dsns {
+			var n Node
+			if nl != nil {
+				n, _ = nl.LookupNode(dsn)
+			}
+			switch {
+			case zone == "" || n.Zone != zone:
+				remote = append(remote, dsn)
+			case capacity > 0 && cc != nil && cc.OpenConns(dsn) >= capacity:
+				overCapacity = append(overCapacity, dsn)
+			default:
+				local = append(local, dsn)
+			}
+		}
+
+		var c driver.Conn
+		var err error
+		for i, preferred := range [...][]string{local, remote, overCapacity} {
+			if len(preferred) == 0 {
+				continue
+			}
+			if c, err = selectors[i](ctx, d, preferred); err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		return c, err
+	}
+}
@@ -0,0 +1,92 @@
+package rwproxy_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"testing"
+
+	"github.com/nedscode/rwproxy"
+)
+
+func TestZoneReaderSelector(t *testing.T) {
+	cases := []struct {
+		name     string
+		zone     string
+		env      string
+		capacity int
+		down     string
+		expected []string
+	}{
+		{
+			name:     "local zone",
+			zone:     "zone-a",
+			expected: []string{"reader-a", "reader-a", "reader-a"},
+		},
+		{
+			name:     "local zone from environment",
+			env:      "zone-b",
+			expected: []string{"reader-b1", "reader-b2", "reader-b1"},
+		},
+		{
+			name:     "no local zone",
+			expected: []string{"reader-a", "reader-b1", "reader-b2"},
+		},
+		{
+			name:     "local zone down",
+			zone:     "zone-a",
+			down:     "reader-a",
+			expected: []string{"reader-b1", "reader-b2", "reader-b1"},
+		},
+		{
+			name:     "local zone over capacity",
+			zone:     "zone-a",
+			capacity: 1,
+			expected: []string{"reader-a", "reader-b1", "reader-b2"},
+		},
+	}
+
+	dsn := rwproxy.Cluster{
+		Writer: rwproxy.Node{DSN: "writer"},
+		Readers: []rwproxy.Node{
+			{DSN: "reader-a", Zone: "zone-a"},
+			{DSN: "reader-b1", Zone: "zone-b"},
+			{DSN: "reader-b2", Zone: "zone-b"},
+		},
+	}.StructuredDSN()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			os.Setenv(rwproxy.ZoneEnv, c.env)
+			defer os.Unsetenv(rwproxy.ZoneEnv)
+
+			rs := &replicaSet{primary: "writer", down: c.down}
+			d := rwproxy.New(rs, rwproxy.WithReaderSelector(rwproxy.ZoneReaderSelector(c.zone, c.capacity, nil)))
+			for _, expected := range c.expected {
+				conn, err := d.Open(dsn)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				defer conn.Close()
+				if err := conn.(driver.Pinger).Ping(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if n := d.Stats().ReaderConns[expected]; n == 0 {
+					t.Errorf("expected a connection to %s; got %v", expected, d.Stats().ReaderConns)
+				}
+			}
+			total := 0
+			for _, n := range d.Stats().ReaderConns {
+				total += n
+			}
+			if total != len(c.expected) {
+				t.Errorf("expected %d reader connections; got %v", len(c.expected), d.Stats().ReaderConns)
+			}
+		})
+	}
+}
+
+func TestZoneReaderSelector_concurrent(t *testing.T) {
+	// readers of each preference are selected round robin by default
+	selectConcurrently(t, rwproxy.ZoneReaderSelector("zone-a", 0, nil))
+}